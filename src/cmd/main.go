@@ -1,16 +1,62 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"generator/internal"
 )
 
+// commands maps sub-command names to their handlers. Each handler receives the
+// arguments that follow the sub-command name.
+var commands = map[string]func(args []string) error{
+	"logs":      internal.LogsCommand,
+	"shell":     internal.ShellCommand,
+	"composer":  internal.ComposerCommand,
+	"artisan":   internal.ArtisanCommand,
+	"npm":       internal.NpmCommand,
+	"yarn":      internal.YarnCommand,
+	"mysql":     internal.MySQLCommand,
+	"prune":     internal.PruneCommand,
+	"db":        internal.DbCommand,
+	"secrets":   internal.SecretsCommand,
+	"route":     internal.RouteCommand,
+	"expose":    internal.ExposeCommand,
+	"link":      internal.LinkCommand,
+	"unlink":    internal.UnlinkCommand,
+	"templates": internal.TemplatesCommand,
+	"set":       internal.SetCommand,
+	"php":       internal.PHPCommand,
+	"upgrade":   internal.UpgradeCommand,
+	"config":    internal.ConfigCommand,
+	"adopt":     internal.AdoptCommand,
+	"rename":    internal.RenameCommand,
+	"export":    internal.ExportCommand,
+	"import":    internal.ImportCommand,
+}
+
 func main() {
-	args := os.Args
+	// -o KEY=VALUE overrides a setting of .env or the user config for this run
+	args, err := internal.ApplyConfigOverrides(os.Args)
+	if err != nil {
+		fmt.Println(internal.Error("Error:"), err)
+		os.Exit(1)
+	}
+
+	// Every path is relative to the workspace root, wherever dockdev is started
+	if err := internal.EnterWorkspace(); err != nil {
+		fmt.Println(internal.Error("Error:"), err)
+		os.Exit(1)
+	}
 
 	// Process command-line arguments
 	if len(args) > 1 {
+		// `dockdev create <domain>` is the same as `dockdev <domain>`
+		if args[1] == "create" && len(args) > 2 {
+			args = append(args[:1:1], args[2:]...)
+		}
+
 		// Check for help command
 		if args[1] == "-H" || args[1] == "--help" {
 			internal.PrintSectionDivider("HELP")
@@ -20,8 +66,18 @@ func main() {
 
 		// Check for delete command
 		if args[1] == "rm" {
-			if len(args) == 3 {
-				internal.DeleteProject(args[2])
+			if len(args) >= 3 {
+				// --backup / --no-backup skip the question about dumping the project database
+				var backup []bool
+				for _, arg := range args[3:] {
+					switch arg {
+					case "--backup":
+						backup = []bool{true}
+					case "--no-backup":
+						backup = []bool{false}
+					}
+				}
+				internal.DeleteProject(args[2], backup...)
 				
 				// After deletion, if in interactive terminal mode, ask if user wants to continue
 				if internal.IsTerminal() {
@@ -57,16 +113,70 @@ func main() {
 			return
 		}
 
+		// Check for other sub-commands
+		if command, ok := commands[args[1]]; ok {
+			if err := command(internal.ProjectArgs(args[1], args[2:])); err != nil {
+				// Commands run inside containers exit with the container command's code
+				var exitErr *internal.ExitCodeError
+				if errors.As(err, &exitErr) {
+					os.Exit(exitErr.Code)
+				}
+				fmt.Println(internal.Error("Error:"), err)
+				os.Exit(1)
+			}
+			return
+		}
+
 		// Assume the argument is a domain name - direct project creation
 		internal.PrintSectionDivider("CREATING PROJECT: " + args[1])
 		
-		// Parse SSL flag if provided (not normally used from CLI but added for completeness)
-		useSSL := true
-		if len(args) > 2 && args[2] == "--no-ssl" {
-			useSSL = false
+		// --no-ssl disables SSL, --db <engine> picks the database engine of the project,
+		// --php, --node and --php-ext choose what the project images are built with,
+		// --set name=value sets a template variable and may be repeated,
+		// --from <dir> [--branch name] [--mount] starts from existing code
+		opts := internal.DefaultProjectOptions()
+		source := &internal.AppSource{}
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--no-ssl":
+				opts.UseSSL = false
+				continue
+			case "--mount":
+				source.Mounted = true
+				continue
+			}
+			name, value, ok := flagValue(args, &i)
+			if !ok {
+				continue
+			}
+			switch name {
+			case "--db":
+				opts.Engine = value
+			case "--php":
+				opts.Stack.PHPVersion = value
+			case "--node":
+				opts.Stack.NodeVersion = value
+			case "--php-ext":
+				opts.Stack.PHPExtensions = internal.ParsePHPExtensions(value)
+			case "--set":
+				if err := opts.SetVar(value); err != nil {
+					fmt.Println(internal.Error("Error:"), err)
+					os.Exit(1)
+				}
+			case "--from":
+				source.Path = value
+			case "--branch":
+				source.Branch = value
+			}
+		}
+		if source.Path != "" {
+			opts.Source = source
+		} else if source.Branch != "" || source.Mounted {
+			fmt.Println(internal.Error("Error:"), "--branch and --mount need --from <dir>")
+			os.Exit(1)
 		}
 		
-		if err := internal.GenerateProject(args[1], useSSL); err != nil {
+		if err := internal.GenerateProject(args[1], opts); err != nil {
 			fmt.Println(internal.Error("Error:"), err)
 			os.Exit(1)
 		}
@@ -100,4 +210,20 @@ func main() {
 		fmt.Println("\n" + internal.Error("Error: No domain specified. Please provide a domain name or run in an interactive terminal."))
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
+
+// flagValue reads a "--name value" or "--name=value" flag at args[*i], advancing i past the value
+func flagValue(args []string, i *int) (string, string, bool) {
+	arg := args[*i]
+	if !strings.HasPrefix(arg, "--") {
+		return "", "", false
+	}
+	if name, value, ok := strings.Cut(arg, "="); ok {
+		return name, value, true
+	}
+	if *i+1 >= len(args) {
+		return "", "", false
+	}
+	*i++
+	return arg, args[*i], true
+}
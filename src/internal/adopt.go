@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdoptedStack is a compose stack dockdev serves without having generated it. Its files
+// stay where they are, dockdev only adds an override that attaches one of its services
+// to the proxy network.
+type AdoptedStack struct {
+	Dir     string   `json:"dir"`     // directory of the stack, its compose project directory
+	Files   []string `json:"files"`   // the stack's compose files, relative to Dir
+	Service string   `json:"service"` // the service the domain is served from
+}
+
+// composeFileNames are the files docker compose looks for, in its order of preference
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// composeConfig is the part of `docker compose config --format json` adopt needs
+type composeConfig struct {
+	Name     string `json:"name"`
+	Services map[string]struct {
+		NetworkMode string                     `json:"network_mode"`
+		Networks    map[string]json.RawMessage `json:"networks"`
+	} `json:"services"`
+}
+
+// findComposeFiles returns the compose file of a directory and its override file, the
+// ones `docker compose` picks up there by default
+func findComposeFiles(dir string) ([]string, error) {
+	for _, name := range composeFileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			continue
+		}
+		files := []string{name}
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		for _, ext := range []string{".yaml", ".yml"} {
+			if _, err := os.Stat(filepath.Join(dir, base+".override"+ext)); err == nil {
+				files = append(files, base+".override"+ext)
+				break
+			}
+		}
+		return files, nil
+	}
+	return nil, fmt.Errorf("no compose file found in %s (looked for %s)", dir, strings.Join(composeFileNames, ", "))
+}
+
+// composeArgs returns the docker arguments that run the stack with the override in projectDir
+func (a *AdoptedStack) composeArgs(projectDir, name string) []string {
+	args := []string{"compose", "--project-directory", a.Dir}
+	if name != "" {
+		args = append(args, "-p", name)
+	}
+	for _, file := range a.Files {
+		args = append(args, "-f", filepath.Join(a.Dir, file))
+	}
+	override, _ := filepath.Abs(filepath.Join(projectDir, AdoptOverrideFile))
+	return append(args, "-f", override)
+}
+
+// config reads the stack's resolved compose configuration, without the override
+func (a *AdoptedStack) config() (*composeConfig, error) {
+	args := []string{"compose"}
+	for _, file := range a.Files {
+		args = append(args, "-f", file)
+	}
+	cmd := exec.Command("docker", append(args, "config", "--format", "json")...)
+	cmd.Dir = a.Dir
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("invalid compose stack in %s: %s", a.Dir, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to read the compose stack in %s: %w", a.Dir, err)
+	}
+
+	config := &composeConfig{}
+	if err := json.Unmarshal(output, config); err != nil {
+		return nil, fmt.Errorf("failed to parse compose config of %s: %w", a.Dir, err)
+	}
+	return config, nil
+}
+
+// adoptedState returns the state of the adopted stack registered in a project directory,
+// nil for generated projects
+func adoptedState(dir string) *ProjectState {
+	content, err := os.ReadFile(filepath.Join(dir, ProjectStateDir, ProjectStateFile))
+	if err != nil {
+		return nil
+	}
+	state := &ProjectState{}
+	if err := json.Unmarshal(content, state); err != nil || state.Adopted == nil {
+		return nil
+	}
+	return state
+}
+
+// requireGenerated stops commands that work on the files dockdev renders from templates
+func (s *ProjectState) requireGenerated(command string) error {
+	if s.Adopted != nil {
+		return fmt.Errorf("%s is an adopted compose stack in %s, `dockdev %s` only works on projects dockdev generated", s.Domain, s.Adopted.Dir, command)
+	}
+	return nil
+}
+
+// detachAdoptedStack takes the served service off the dockdev network. The stack is not
+// dockdev's to stop, it keeps running as its owner left it; its next `docker compose up`
+// recreates the container without the override.
+func detachAdoptedStack(state *ProjectState) error {
+	network := os.Getenv(EnvNetworkName)
+	output, err := exec.Command("docker", "ps", "-aq",
+		"--filter", "label=com.docker.compose.project="+state.ComposeProject,
+		"--filter", "label=com.docker.compose.service="+state.Adopted.Service).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list the containers of %s: %w", state.Adopted.Service, err)
+	}
+	for _, id := range strings.Fields(string(output)) {
+		output, err := exec.Command("docker", "network", "disconnect", network, id).CombinedOutput()
+		if err != nil && !strings.Contains(string(output), "is not connected") {
+			return fmt.Errorf("failed to disconnect %s from %s: %s", state.Adopted.Service, network, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// writeAdoptOverride writes the compose override that puts the served service on the
+// dockdev network. keepDefault keeps it on the stack's default network as well, which an
+// explicit networks list would otherwise replace.
+func writeAdoptOverride(projectDir string, state *ProjectState, keepDefault bool) error {
+	service := state.Adopted.Service
+	network := os.Getenv(EnvNetworkName)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by `dockdev adopt`: attaches %s to %s, so nginx-reverse-proxy serves\n", service, network)
+	fmt.Fprintf(&b, "# it on %s. The stack's own compose files in %s are not changed.\n", state.Domain, state.Adopted.Dir)
+	b.WriteString("services:\n")
+	fmt.Fprintf(&b, "  %s:\n", service)
+	b.WriteString("    networks:\n")
+	if keepDefault {
+		b.WriteString("      default: {}\n")
+	}
+	fmt.Fprintf(&b, "      %s:\n", network)
+	fmt.Fprintf(&b, "        ipv4_address: %s\n", state.IPsByService[service])
+	b.WriteString("\nnetworks:\n")
+	fmt.Fprintf(&b, "  %s:\n", network)
+	b.WriteString("    external: true\n")
+
+	return os.WriteFile(filepath.Join(projectDir, AdoptOverrideFile), []byte(b.String()), 0644)
+}
+
+// AdoptCommand implements `dockdev adopt <dir> --domain <domain> --service <service> [--port 80] [--no-ssl]`
+func AdoptCommand(args []string) error {
+	usage := fmt.Errorf("usage: adopt <dir> --domain <domain> --service <service> [--port 80] [--no-ssl]")
+	parsed, err := parseArgs(args, "domain", "service", "port")
+	if err != nil {
+		return err
+	}
+	domain, service := parsed.Get("domain", ""), parsed.Get("service", "")
+	if len(parsed.Positional) != 1 || domain == "" || service == "" {
+		return usage
+	}
+	if err := validateDomain(domain); err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(parsed.Get("port", "80"))
+	if err != nil {
+		return fmt.Errorf("invalid port %q", parsed.Get("port", ""))
+	}
+
+	dir, err := filepath.Abs(userPath(parsed.Positional[0]))
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", parsed.Positional[0])
+	}
+	projectDir := ProjectDir(domain)
+	if _, err := os.Stat(projectDir); err == nil {
+		return fmt.Errorf("Project already exists: %s", projectDir)
+	}
+	if links, err := loadLinks(); err == nil {
+		if _, ok := links[domain]; ok {
+			return fmt.Errorf("%s is linked to %s, run `dockdev unlink %s` first", domain, links[domain].Upstream, domain)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(SharedServicesDir, DockerComposeFile)); err != nil {
+		return fmt.Errorf("shared-services is not set up yet, create a dockdev project first")
+	}
+
+	if err := EnsureDockerRunning(); err != nil {
+		return fmt.Errorf("Docker check failed: %w", err)
+	}
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	files, err := findComposeFiles(dir)
+	if err != nil {
+		return err
+	}
+	stack := &AdoptedStack{Dir: dir, Files: files, Service: service}
+	config, err := stack.config()
+	if err != nil {
+		return err
+	}
+	served, ok := config.Services[service]
+	if !ok {
+		var names []string
+		for name := range config.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("service %q not found in %s (services: %s)", service, dir, strings.Join(names, ", "))
+	}
+	if served.NetworkMode != "" {
+		return fmt.Errorf("service %s uses network_mode %q and can't join the %s network", service, served.NetworkMode, os.Getenv(EnvNetworkName))
+	}
+	_, onDefault := served.Networks["default"]
+	keepDefault := onDefault || len(served.Networks) == 0
+
+	// A stack can only be attached once, its containers would otherwise get two addresses
+	projects, err := ListExistingProjects()
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		if existing, err := LoadProjectState(project); err == nil && existing.ComposeProject == config.Name {
+			return fmt.Errorf("the compose project %s is already served as %s", config.Name, project)
+		}
+	}
+
+	ipMap, err := nextServiceIPs(os.Getenv(EnvProjectStartIP), []string{service}, map[string]string{})
+	if err != nil {
+		return err
+	}
+	state := &ProjectState{
+		Domain:         domain,
+		Prefix:         projectPrefix(domain),
+		ComposeProject: config.Name,
+		UseSSL:         SSLEnabled && !parsed.Has("no-ssl"),
+		IPsByService:   ipMap,
+		User:           currentUserMapping(),
+		Routes:         []Route{{Path: "/", Service: service, Port: port, WebSocket: true}},
+		Adopted:        stack,
+		CreatedAt:      time.Now(),
+	}
+	if err := state.Routes[0].validate(state); err != nil {
+		return err
+	}
+
+	PrintSectionDivider("ADOPTING " + config.Name + " AS " + domain)
+
+	if err := ensureWorkspaceMarker(); err != nil {
+		return fmt.Errorf("failed to mark the workspace root: %w", err)
+	}
+	if err := CreateDirIfNotExist(projectDir); err != nil {
+		return fmt.Errorf("failed to create project directory: %w", err)
+	}
+	if err := writeAdoptOverride(projectDir, state, keepDefault); err != nil {
+		return err
+	}
+	fmt.Println(Success("Generated compose override:"), Info(filepath.Join(projectDir, AdoptOverrideFile)))
+	if err := SaveProjectState(state); err != nil {
+		return fmt.Errorf("failed to save project state: %w", err)
+	}
+	if err := recordServiceIPs(domain, []string{service}, ipMap); err != nil {
+		return err
+	}
+
+	if state.UseSSL {
+		if err := ensureRootCA(CertsDir); err != nil {
+			return fmt.Errorf("SSL rootCA failed: %w", err)
+		}
+		if _, _, err := generateDomainCert(domain, CertsDir); err != nil {
+			return fmt.Errorf("Domain SSL generation failed: %w", err)
+		}
+	}
+
+	fmt.Println("Starting shared-services...")
+	if err := runDockerComposeUp(SharedServicesDir); err != nil {
+		return err
+	}
+	if err := runDockerComposeUp(projectDir); err != nil {
+		return err
+	}
+	if err := applyProxySite(state); err != nil {
+		return err
+	}
+
+	state.refreshContainers()
+	if err := SaveProjectState(state); err != nil {
+		return fmt.Errorf("failed to save project state: %w", err)
+	}
+	if err := CurrentPlatform().AddHostsEntry(domain); err != nil {
+		return err
+	}
+
+	url := GetProjectURL(domain)
+	if _, err := waitForProjectURL(domain, url, ReadinessTimeout); err != nil {
+		return fmt.Errorf("%s is not reachable: %w", url, err)
+	}
+
+	fmt.Println(Success("Adopted"), Bold(config.Name), Success("as"), Bold(Highlight(url)), Info("->"), Info(fmt.Sprintf("%s:%d", service, port)))
+	fmt.Println(Info("Run it by hand with:"), Highlight("docker compose "+strings.Join(stack.composeArgs(projectDir, config.Name)[1:], " ")+" up -d"))
+	return nil
+}
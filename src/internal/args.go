@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParsedArgs holds positional arguments and flags of a sub-command
+type ParsedArgs struct {
+	Positional []string
+	Flags      map[string]string
+}
+
+// Has reports whether the flag was given
+func (a ParsedArgs) Has(name string) bool {
+	_, ok := a.Flags[name]
+	return ok
+}
+
+// Get returns the flag value or def if the flag was not given
+func (a ParsedArgs) Get(name, def string) string {
+	if v, ok := a.Flags[name]; ok {
+		return v
+	}
+	return def
+}
+
+// parseArgs splits args into positional arguments and flags. Flags may appear anywhere and are
+// written as --name, --name=value or -n. Flags listed in valueFlags consume the next argument as
+// their value when it isn't given with "=". Everything after "--" is positional.
+func parseArgs(args []string, valueFlags ...string) (ParsedArgs, error) {
+	parsed := ParsedArgs{Flags: map[string]string{}}
+
+	takesValue := make(map[string]bool, len(valueFlags))
+	for _, f := range valueFlags {
+		takesValue[f] = true
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			parsed.Positional = append(parsed.Positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			parsed.Positional = append(parsed.Positional, arg)
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		value := ""
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value = name[:eq], name[eq+1:]
+		} else if takesValue[name] {
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("flag %s requires a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+		parsed.Flags[name] = value
+	}
+
+	return parsed, nil
+}
@@ -4,12 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
-// OpenBrowser opens the specified URL in the default Windows browser
+// OpenBrowser opens the specified URL in the default browser of the current platform
 func OpenBrowser(url string) error {
 	PrintDivider()
 	fmt.Println(Bold("OPENING PROJECT IN BROWSER"))
@@ -21,12 +20,7 @@ func OpenBrowser(url string) error {
 
 	fmt.Println(Info("Opening URL in default browser:"), Highlight(url))
 
-	// Use PowerShell to open the default browser
-	// Using Start-Process for better process management
-	cmd := exec.Command("powershell.exe", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command",
-		fmt.Sprintf(`Start-Process "%s"`, url))
-
-	err := cmd.Run()
+	err := CurrentPlatform().OpenURL(url)
 	if err != nil {
 		fmt.Println(Error("Failed to open browser:"), Error(err.Error()))
 		return err
@@ -0,0 +1,653 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bundleVersion is the bundle layout written by export, import refuses newer ones
+const bundleVersion = 1
+
+// Entries of a project bundle
+const (
+	bundleManifestName = "dockdev-bundle.json"
+	bundleProjectDir   = "project"         // customised project files
+	bundleBaseDir      = "base"            // the template versions those files were edited from
+	bundleAppDir       = "app"             // the code, with --app
+	bundleDatabaseName = "database.sql.gz" // dump of the project database, with --db
+)
+
+// bundleRoots are the parts of a project whose customisations go into a bundle
+var bundleRoots = []string{DockerComposeFile, "conf", "image"}
+
+// bundleSkipped are files that belong to the machine or to runtime switches, not the project
+var bundleSkipped = []string{"conf/nginx/ssl", "conf/php/" + PHPModesDir}
+
+// bundleAppSkipped are app directories the containers install again on first start
+var bundleAppSkipped = []string{"vendor", "node_modules"}
+
+// bundleManifest describes the project in a bundle. Addresses, certificates and the
+// database password are left out, the receiving machine gets its own.
+type bundleManifest struct {
+	Version          int               `json:"version"`
+	Domain           string            `json:"domain"`
+	UseSSL           bool              `json:"use_ssl"`
+	Engine           string            `json:"engine,omitempty"`
+	Stack            *StackState       `json:"stack,omitempty"`
+	Vars             map[string]string `json:"vars,omitempty"`
+	Routes           []Route           `json:"routes,omitempty"`
+	Exposures        []Exposure        `json:"exposures,omitempty"`
+	DisabledServices []string          `json:"disabled_services,omitempty"`
+	Files            []string          `json:"files,omitempty"` // customised files under project/
+	App              bool              `json:"app,omitempty"`
+	Database         bool              `json:"database,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+// bundleWriter writes the entries of a gzipped tar file
+type bundleWriter struct {
+	tw *tar.Writer
+}
+
+// addBytes adds a file entry with the given content
+func (w *bundleWriter) addBytes(name string, content []byte, mode os.FileMode) error {
+	header := &tar.Header{Name: name, Mode: int64(mode.Perm()), Size: int64(len(content)), ModTime: time.Now()}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(content)
+	return err
+}
+
+// addTree adds the files below dir under prefix, leaving out the top level names in skip
+func (w *bundleWriter) addTree(prefix, dir string, skip []string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.Contains(skip, rel) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = prefix + "/" + rel
+		if err := w.tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(w.tw, file)
+		return err
+	})
+}
+
+// customisedProjectFiles returns the project files that differ from the template version
+// they were rendered as, and files the templates don't have, relative to the project
+func customisedProjectFiles(projectDir string) ([]string, error) {
+	var files []string
+	for _, root := range bundleRoots {
+		err := filepath.WalkDir(filepath.Join(projectDir, root), func(path string, entry fs.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(projectDir, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if slices.Contains(bundleSkipped, rel) {
+				return filepath.SkipDir
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			base, err := readOptional(filepath.Join(baseDir(projectDir), filepath.FromSlash(rel)))
+			if err != nil {
+				return err
+			}
+			if base == nil || !bytes.Equal(base, content) {
+				files = append(files, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// ExportCommand implements `dockdev export <domain> [bundle.tar.gz] [--app] [--db]`
+func ExportCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 {
+		return fmt.Errorf("usage: export <domain> [bundle.tar.gz] [--app] [--db]")
+	}
+	domain := parsed.Positional[0]
+	file := domain + ".tar.gz"
+	if len(parsed.Positional) > 1 {
+		file = parsed.Positional[1]
+	}
+	file = userPath(file)
+
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+	if err := state.requireGenerated("export"); err != nil {
+		return err
+	}
+	projectDir := ProjectDir(domain)
+
+	manifest := bundleManifest{
+		Version:          bundleVersion,
+		Domain:           domain,
+		UseSSL:           state.UseSSL,
+		Stack:            state.Stack,
+		Vars:             state.Vars,
+		Routes:           state.Routes,
+		Exposures:        state.Exposures,
+		DisabledServices: state.DisabledServices,
+		App:              parsed.Has("app"),
+		Database:         parsed.Has("db"),
+		CreatedAt:        time.Now(),
+	}
+	if state.Database != nil {
+		manifest.Engine = state.Database.Engine
+	}
+	if manifest.Database && state.Database == nil {
+		return fmt.Errorf("project %s has no database of its own (created before per-project databases)", domain)
+	}
+	if manifest.Files, err = customisedProjectFiles(projectDir); err != nil {
+		return err
+	}
+
+	// The dump is taken first, it is the step most likely to fail
+	var dump string
+	if manifest.Database {
+		if err := CheckDockerRunning(); err != nil {
+			return err
+		}
+		fmt.Println(Highlight("Dumping database"), Bold(state.Database.Name), Highlight("..."))
+		if dump, err = backupProjectDatabase(domain, state.Database); err != nil {
+			return fmt.Errorf("database dump failed: %w", err)
+		}
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := writeBundle(out, projectDir, manifest, state, dump); err != nil {
+		out.Close()
+		os.Remove(file)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	fmt.Println(Success("Exported"), Bold(domain), Success("to"), Info(file))
+	fmt.Printf("  %d customised file(s)", len(manifest.Files))
+	if manifest.App {
+		fmt.Print(", app/")
+	}
+	if manifest.Database {
+		fmt.Print(", database dump")
+	}
+	fmt.Println()
+	fmt.Println(Info("Import it with:"), Highlight("dockdev import "+filepath.Base(file)+" [--domain name]"))
+	return nil
+}
+
+// writeBundle writes the bundle entries to out
+func writeBundle(out io.Writer, projectDir string, manifest bundleManifest, state *ProjectState, dump string) error {
+	gz := gzip.NewWriter(out)
+	w := &bundleWriter{tw: tar.NewWriter(gz)}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.addBytes(bundleManifestName, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+
+	for _, name := range manifest.Files {
+		local := filepath.Join(projectDir, filepath.FromSlash(name))
+		content, err := os.ReadFile(local)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(local)
+		if err != nil {
+			return err
+		}
+		if err := w.addBytes(path.Join(bundleProjectDir, name), content, info.Mode()); err != nil {
+			return err
+		}
+		base, err := readOptional(filepath.Join(baseDir(projectDir), filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if base != nil {
+			if err := w.addBytes(path.Join(bundleBaseDir, name), base, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	if manifest.App {
+		appDir := filepath.Join(projectDir, "app")
+		if state.Source != nil && state.Source.Mounted {
+			appDir = state.Source.Path
+		}
+		fmt.Println(Highlight("Adding"), Info(appDir), Highlight("without"), Info(strings.Join(bundleAppSkipped, ", ")))
+		if err := w.addTree(bundleAppDir, appDir, bundleAppSkipped); err != nil {
+			return fmt.Errorf("failed to add the app: %w", err)
+		}
+	}
+
+	if dump != "" {
+		content, err := os.ReadFile(dump)
+		if err != nil {
+			return err
+		}
+		if err := w.addBytes(bundleDatabaseName, content, 0600); err != nil {
+			return err
+		}
+	}
+
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// extractBundle unpacks a bundle into dir and returns its manifest
+func extractBundle(file, dir string) (*bundleManifest, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a dockdev bundle: %w", file, err)
+	}
+	defer gz.Close()
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		name, err := bundleEntryName(header.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%w in %s", err, file)
+		}
+		target := filepath.Join(root, filepath.FromSlash(name))
+		// A link extracted earlier may not lead a later entry out of the directory
+		if err := checkInsideDir(root, filepath.Dir(target)); err != nil {
+			return nil, fmt.Errorf("invalid entry %q in %s: %w", header.Name, file, err)
+		}
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return nil, fmt.Errorf("invalid entry %q in %s: it replaces a link", header.Name, file)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			if !bundleLinkInside(name, header.Linkname) {
+				fmt.Println(Warning("Skipped the link"), Info(name+" -> "+header.Linkname), Warning("- it points outside the bundle"))
+				continue
+			}
+			err = os.Symlink(header.Linkname, target)
+		case tar.TypeReg:
+			var out *os.File
+			if out, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm()); err == nil {
+				_, err = io.Copy(out, tr)
+				out.Close()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, bundleManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a dockdev bundle, it has no %s", file, bundleManifestName)
+	}
+	manifest := &bundleManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", bundleManifestName, file, err)
+	}
+	if manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("%s was exported by a newer dockdev (bundle version %d), update dockdev first", file, manifest.Version)
+	}
+	for _, name := range manifest.Files {
+		if err := checkBundleFile(name); err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", bundleManifestName, file, err)
+		}
+	}
+	return manifest, nil
+}
+
+// bundleEntryName returns the cleaned name of a tar entry, which may not leave the
+// extraction directory
+func bundleEntryName(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid entry %q", name)
+	}
+	return clean, nil
+}
+
+// bundleLinkInside reports whether a link entry points to a path inside the bundle
+func bundleLinkInside(name, link string) bool {
+	if link == "" || path.IsAbs(link) || strings.Contains(link, "\\") {
+		return false
+	}
+	resolved := path.Join(path.Dir(name), link)
+	return resolved != ".." && !strings.HasPrefix(resolved, "../")
+}
+
+// checkInsideDir checks that dir, with the links of the part that exists resolved, is
+// root or below it. The missing part is created as plain directories.
+func checkInsideDir(root, dir string) error {
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside the bundle", resolved)
+	}
+	return nil
+}
+
+// checkBundleFile checks a customised file listed in a manifest: a clean relative path in
+// one of the bundleRoots, as export writes them
+func checkBundleFile(name string) error {
+	if name != path.Clean(name) || path.IsAbs(name) || strings.Contains(name, "\\") || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("invalid file %q", name)
+	}
+	for _, skipped := range bundleSkipped {
+		if name == skipped || strings.HasPrefix(name, skipped+"/") {
+			return fmt.Errorf("file %q is not part of a bundle", name)
+		}
+	}
+	for _, root := range bundleRoots {
+		if name == root || strings.HasPrefix(name, root+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("file %q is outside %s", name, strings.Join(bundleRoots, ", "))
+}
+
+// ImportCommand implements `dockdev import <bundle.tar.gz> [--domain name]`
+func ImportCommand(args []string) error {
+	parsed, err := parseArgs(args, "domain")
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) != 1 {
+		return fmt.Errorf("usage: import <bundle.tar.gz> [--domain name]")
+	}
+
+	dir, err := os.MkdirTemp("", "dockdev-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := extractBundle(userPath(parsed.Positional[0]), dir)
+	if err != nil {
+		return err
+	}
+	domain := parsed.Get("domain", manifest.Domain)
+	if err := validateDomain(domain); err != nil {
+		return fmt.Errorf("bundle for %q: %w", manifest.Domain, err)
+	}
+	PrintSectionDivider("IMPORTING PROJECT: " + domain)
+
+	// The project is created like a new one, so it gets addresses and certificates of this machine
+	opts := DefaultProjectOptions()
+	opts.UseSSL = manifest.UseSSL
+	opts.Engine = manifest.Engine
+	if manifest.Stack != nil {
+		opts.Stack = *manifest.Stack
+	}
+	opts.Vars = manifest.Vars
+	opts.DisabledServices = manifest.DisabledServices
+	if opts.DisabledServices == nil {
+		opts.DisabledServices = []string{}
+	}
+	if manifest.App {
+		opts.Source = bundleAppSource(dir)
+	}
+	if err := generateProject(domain, opts); err != nil {
+		return err
+	}
+
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+	// The app was copied from the bundle, there is nothing to remember about it
+	state.Source = nil
+
+	changed, err := importBundleFiles(dir, ProjectDir(domain), manifest.Files)
+	if err != nil {
+		return err
+	}
+	if err := importRoutes(state, manifest); err != nil {
+		return err
+	}
+	if err := SaveProjectState(state); err != nil {
+		return err
+	}
+
+	if manifest.Database {
+		fmt.Println(Highlight("Importing the database dump into"), Bold(state.Database.Name))
+		if err := importDatabaseFromFile(state.Database, filepath.Join(dir, bundleDatabaseName)); err != nil {
+			return fmt.Errorf("database import failed: %w", err)
+		}
+	}
+
+	if changed {
+		fmt.Println(Highlight("Recreating the containers with the imported files..."))
+		cmd := composeCommand(ProjectDir(domain), "up", "-d", "--build", "--force-recreate")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to recreate the containers: %w", err)
+		}
+		if err := waitForProjectReady(domain, ProjectDir(domain)); err != nil {
+			return err
+		}
+	}
+
+	announceProject(domain)
+	return nil
+}
+
+// bundleAppSource returns the app extracted from a bundle as the source of the new project.
+// It is copied, a clone would lose the uncommitted files export put in and point its
+// origin at the extraction directory.
+func bundleAppSource(dir string) *AppSource {
+	return &AppSource{Path: filepath.Join(dir, bundleAppDir), Copy: true}
+}
+
+// importBundleFiles merges the customised files of a bundle into the new project. A file
+// exported with its template version keeps the edits on top of the newly rendered file;
+// one that can't be merged is kept next to it as <file>.bundle. Returns whether anything changed.
+func importBundleFiles(bundleDir, projectDir string, files []string) (bool, error) {
+	changed := false
+	for _, name := range files {
+		bundled, err := os.ReadFile(filepath.Join(bundleDir, bundleProjectDir, filepath.FromSlash(name)))
+		if err != nil {
+			return changed, err
+		}
+		base, err := readOptional(filepath.Join(bundleDir, bundleBaseDir, filepath.FromSlash(name)))
+		if err != nil {
+			return changed, err
+		}
+		target := filepath.Join(projectDir, filepath.FromSlash(name))
+		current, err := readOptional(target)
+		if err != nil {
+			return changed, err
+		}
+
+		content := bundled
+		switch {
+		case current == nil || bytes.Equal(current, bundled):
+			// A file the templates don't have, or one that is already the same
+		case base != nil:
+			merged, conflicts, err := mergeThreeWay(bundled, base, current)
+			if err != nil {
+				return changed, err
+			}
+			if conflicts == 0 {
+				content = merged
+				break
+			}
+			fallthrough
+		case renderedPerMachine(name):
+			// Addresses and names in it are those of the exporting machine
+			if err := os.WriteFile(target+".bundle", bundled, 0644); err != nil {
+				return changed, err
+			}
+			fmt.Println(Warning("Kept the new"), Info(target), Warning("- merge your changes from"), Info(target+".bundle"))
+			continue
+		}
+
+		if bytes.Equal(current, content) {
+			continue
+		}
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(filepath.Join(bundleDir, bundleProjectDir, filepath.FromSlash(name))); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return changed, err
+		}
+		if err := os.WriteFile(target, content, mode); err != nil {
+			return changed, err
+		}
+		fmt.Println(Success("Imported"), Info(target))
+		changed = true
+	}
+	return changed, nil
+}
+
+// renderedPerMachine reports whether a project file holds addresses or names given out by
+// the machine it was rendered on
+func renderedPerMachine(name string) bool {
+	return name == DockerComposeFile || name == "conf/nginx/default.conf"
+}
+
+// importRoutes applies the routes and exposures of a bundle to the new project
+func importRoutes(state *ProjectState, manifest *bundleManifest) error {
+	if len(manifest.Routes) == 0 && slices.Equal(exposedHosts(state), exposedHosts(&ProjectState{Domain: state.Domain, Exposures: manifest.Exposures})) {
+		return nil
+	}
+	for _, route := range manifest.Routes {
+		if err := route.validate(state); err != nil {
+			return fmt.Errorf("route %s of the bundle: %w", route.Path, err)
+		}
+	}
+	for _, exposure := range manifest.Exposures {
+		if err := exposure.validate(state); err != nil {
+			return fmt.Errorf("exposure %s of the bundle: %w", exposure.Subdomain, err)
+		}
+	}
+	state.Routes = manifest.Routes
+	state.Exposures = manifest.Exposures
+
+	if err := issueProjectCert(state); err != nil {
+		return err
+	}
+	if err := applyProxySite(state); err != nil {
+		return err
+	}
+	for _, host := range exposedHosts(state) {
+		if err := CurrentPlatform().AddHostsEntry(host); err != nil {
+			fmt.Println(Warning("Warning: failed to update hosts file:"), Error(err.Error()))
+		}
+	}
+	fmt.Println(Success("Applied the routes and exposed services of the bundle"))
+	return nil
+}
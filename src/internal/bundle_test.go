@@ -0,0 +1,373 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testEntry is one entry of a bundle written by writeTestBundle
+type testEntry struct {
+	name    string
+	content string
+	link    string // target of a symlink entry
+}
+
+// writeTestBundle writes a gzipped tar with the entries and returns its path
+func writeTestBundle(t *testing.T, entries []testEntry) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.link != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: entry.link}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+const testManifest = `{"version": 1, "domain": "shop.test", "files": ["conf/nginx/default.conf"]}`
+
+func TestBundleEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // "" when the entry is refused
+	}{
+		{name: "project/conf/nginx/default.conf", want: "project/conf/nginx/default.conf"},
+		{name: "./app/index.php", want: "app/index.php"},
+		{name: "app/sub/../index.php", want: "app/index.php"},
+		{name: "/etc/passwd"},
+		{name: "../outside"},
+		{name: "app/../../outside"},
+		{name: ".."},
+		{name: "."},
+		{name: `app\..\..\outside`},
+	}
+	for _, tt := range tests {
+		got, err := bundleEntryName(tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("bundleEntryName(%q) = %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("bundleEntryName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestBundleLinkInside(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want bool
+	}{
+		{name: "app/public/storage", link: "../storage/app/public", want: true},
+		{name: "app/current", link: "releases/1", want: true},
+		{name: "app/x", link: "/home/me"},
+		{name: "app/x", link: "../../etc"},
+		{name: "app/a/b", link: "../../../x"},
+		{name: "app/x", link: `..\..\etc`},
+		{name: "app/x", link: ""},
+	}
+	for _, tt := range tests {
+		if got := bundleLinkInside(tt.name, tt.link); got != tt.want {
+			t.Errorf("bundleLinkInside(%q, %q) = %v, want %v", tt.name, tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestCheckBundleFile(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{name: DockerComposeFile, ok: true},
+		{name: "conf/nginx/default.conf", ok: true},
+		{name: "image/php/Dockerfile", ok: true},
+		{name: "conf/../../../x"},
+		{name: "conf/nginx/../../.env"},
+		{name: "/etc/passwd"},
+		{name: "../x"},
+		{name: "app/index.php"},
+		{name: ".env"},
+		{name: "conf/nginx/ssl/shop.test.key"},
+		{name: "conf/php/" + PHPModesDir + "/xdebug.ini"},
+		{name: `conf\..\..\x`},
+	}
+	for _, tt := range tests {
+		if err := checkBundleFile(tt.name); (err == nil) != tt.ok {
+			t.Errorf("checkBundleFile(%q) = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestExtractBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		wantErr bool
+		files   []string // extracted files that must exist
+		missing []string // entries that must not be extracted
+	}{
+		{
+			name: "valid bundle",
+			entries: []testEntry{
+				{name: bundleManifestName, content: testManifest},
+				{name: "project/conf/nginx/default.conf", content: "server {}\n"},
+				{name: "app/storage/app/public/a.txt", content: "a"},
+				{name: "app/public/storage", link: "../storage/app/public"},
+			},
+			files: []string{"project/conf/nginx/default.conf", "app/public/storage/a.txt"},
+		},
+		{
+			name: "entry leaving the directory",
+			entries: []testEntry{
+				{name: bundleManifestName, content: testManifest},
+				{name: "../escaped", content: "x"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "absolute entry",
+			entries: []testEntry{
+				{name: "/tmp/escaped", content: "x"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "link to an absolute path is skipped",
+			entries: []testEntry{
+				{name: bundleManifestName, content: testManifest},
+				{name: "app/x", link: "/"},
+			},
+			missing: []string{"app/x"},
+		},
+		{
+			name: "link out of the bundle is skipped",
+			entries: []testEntry{
+				{name: bundleManifestName, content: testManifest},
+				{name: "app/x", link: "../../.."},
+			},
+			missing: []string{"app/x"},
+		},
+		{
+			name: "entry replacing a link",
+			entries: []testEntry{
+				{name: bundleManifestName, content: testManifest},
+				{name: "app/a.txt", content: "a"},
+				{name: "app/b.txt", link: "a.txt"},
+				{name: "app/b.txt", content: "b"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "manifest file outside the project roots",
+			entries: []testEntry{
+				{name: bundleManifestName, content: `{"version": 1, "domain": "shop.test", "files": ["conf/../../../x"]}`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "newer bundle version",
+			entries: []testEntry{
+				{name: bundleManifestName, content: `{"version": 99, "domain": "shop.test"}`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no manifest",
+			entries: []testEntry{
+				{name: "project/docker-compose.yml", content: "services: {}\n"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			manifest, err := extractBundle(writeTestBundle(t, tt.entries), dir)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("extractBundle succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Domain != "shop.test" {
+				t.Errorf("domain = %q, want shop.test", manifest.Domain)
+			}
+			for _, name := range tt.files {
+				if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+					t.Errorf("%s was not extracted: %v", name, err)
+				}
+			}
+			for _, name := range tt.missing {
+				if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+					t.Errorf("%s was extracted", name)
+				}
+			}
+		})
+	}
+}
+
+// An earlier link must not let a later entry write through it, even if the link itself
+// was written by something other than the bundle
+func TestExtractBundleThroughLink(t *testing.T) {
+	outside := t.TempDir()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "app", "x")); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := writeTestBundle(t, []testEntry{
+		{name: bundleManifestName, content: testManifest},
+		{name: "app/x/.bashrc", content: "evil"},
+	})
+	if _, err := extractBundle(bundle, dir); err == nil {
+		t.Fatal("extractBundle wrote through a link, want an error")
+	}
+	if _, err := os.Stat(filepath.Join(outside, ".bashrc")); err == nil {
+		t.Fatal("a file was written outside the extraction directory")
+	}
+}
+
+func TestImportBundleFiles(t *testing.T) {
+	requireGit(t)
+
+	const (
+		base     = "a\nb\nc\nd\ne\n"
+		bundled  = "A\nb\nc\nd\ne\n" // edited on the exporting machine
+		rendered = "a\nb\nc\nd\nE\n" // rendered on this machine
+	)
+	tests := []struct {
+		name    string
+		file    string
+		bundled string
+		base    string // "" when the bundle has no base
+		current string // "" when the new project has no such file
+		want    string // content of the file afterwards
+		kept    bool   // the bundled version is kept as <file>.bundle
+		changed bool
+	}{
+		{name: "edits merged", file: "conf/php/php.ini", bundled: bundled, base: base, current: rendered, want: "A\nb\nc\nd\nE\n", changed: true},
+		{name: "conflicting edits", file: "conf/php/php.ini", bundled: "a\nb\nc\nd\nX\n", base: base, current: rendered, want: rendered, kept: true},
+		{name: "file of its own", file: "conf/php/extra.ini", bundled: "x=1\n", want: "x=1\n", changed: true},
+		{name: "same as rendered", file: "conf/php/php.ini", bundled: rendered, base: base, current: rendered, want: rendered},
+		{name: "machine file without base", file: DockerComposeFile, bundled: "services: {}\n", current: rendered, want: rendered, kept: true},
+		{name: "machine file merged", file: "conf/nginx/default.conf", bundled: bundled, base: base, current: rendered, want: "A\nb\nc\nd\nE\n", changed: true},
+		{name: "other file without base", file: "image/php/Dockerfile", bundled: "FROM php\n", current: rendered, want: "FROM php\n", changed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundleDir, projectDir := t.TempDir(), t.TempDir()
+			writeTestFile(t, filepath.Join(bundleDir, bundleProjectDir), tt.file, []byte(tt.bundled))
+			if tt.base != "" {
+				writeTestFile(t, filepath.Join(bundleDir, bundleBaseDir), tt.file, []byte(tt.base))
+			}
+			if tt.current != "" {
+				writeTestFile(t, projectDir, tt.file, []byte(tt.current))
+			}
+
+			changed, err := importBundleFiles(bundleDir, projectDir, []string{tt.file})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			target := filepath.Join(projectDir, filepath.FromSlash(tt.file))
+			content, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("content = %q, want %q", content, tt.want)
+			}
+			kept, err := os.ReadFile(target + ".bundle")
+			if tt.kept != (err == nil) {
+				t.Errorf("%s.bundle exists = %v, want %v", tt.file, err == nil, tt.kept)
+			}
+			if tt.kept && string(kept) != tt.bundled {
+				t.Errorf("%s.bundle = %q, want %q", tt.file, kept, tt.bundled)
+			}
+		})
+	}
+}
+
+func TestBundleAppSourceKeepsUntrackedFiles(t *testing.T) {
+	requireGit(t)
+
+	dir := t.TempDir()
+	app := filepath.Join(dir, bundleAppDir)
+	writeTestFile(t, app, "index.php", []byte("<?php echo 1;\n"))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "index.php"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.test", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = app
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+	}
+	// Local state that only a copy keeps
+	writeTestFile(t, app, ".env", []byte("APP_KEY=secret\n"))
+	writeTestFile(t, app, "index.php", []byte("<?php echo 2;\n"))
+
+	target := filepath.Join(t.TempDir(), "app")
+	if err := bundleAppSource(dir).populate(target); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{".env": "APP_KEY=secret\n", "index.php": "<?php echo 2;\n"} {
+		content, err := os.ReadFile(filepath.Join(target, name))
+		if err != nil {
+			t.Fatalf("%s was not imported: %v", name, err)
+		}
+		if string(content) != want {
+			t.Errorf("%s = %q, want %q", name, content, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, ".git")); err != nil {
+		t.Errorf("the repository was not kept: %v", err)
+	}
+	remotes, err := exec.Command("git", "-C", target, "remote").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remotes) > 0 {
+		t.Errorf("the imported app has remotes %q, want none pointing at the extraction directory", remotes)
+	}
+}
@@ -63,18 +63,55 @@ func ShowHelp() {
 	fmt.Println(Bold("Usage:"))
 	fmt.Println("  " + ColoredMessage(ColorGreen, "[domain]") + "              - Create a new project with the given domain")
 	fmt.Println("  " + ColoredMessage(ColorGreen, "[domain] --no-ssl") + "     - Create a project without SSL (not recommended)")
+	fmt.Println("  " + ColoredMessage(ColorGreen, "[domain] --db postgres") + " - Create a project on mysql, mariadb or postgres")
+	fmt.Println("  " + ColoredMessage(ColorGreen, "[domain] --php 8.1 --node 20") + " - Choose PHP and Node.js versions (--php-ext imagick,xdebug)")
+	fmt.Println("  " + ColoredMessage(ColorGreen, "[domain] --set name=value") + " - Set a template variable of the new project (repeatable)")
+	fmt.Println("  " + ColoredMessage(ColorGreen, "create [domain] --from [dir]") + " - Start from existing code, cloned or copied into app/ (--branch name, --mount to use it in place)")
+	fmt.Println("  " + ColoredMessage(ColorGreen, "set [domain] php=8.2 node=20") + " - Change versions or php-ext of a project (--rebuild)")
 	fmt.Println("  " + ColoredMessage(ColorRed, "rm [domain]") + "           - Remove an existing project")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "rename [domain] [new-domain]") + " - Move a project to a new domain, keeping its data and database")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "export [domain] [bundle.tar.gz]") + " - Pack a project's settings and customised conf/ to share it (--app, --db)")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "import [bundle.tar.gz]") + " - Recreate an exported project on this machine (--domain name)")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "logs [domain] [service...]") + " - Show merged container and log file output")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "     -f, --since 10m, --tail N") + " - Follow, limit by time or number of lines")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "logs proxy") + "            - Show reverse proxy logs")
+	fmt.Println("  " + ColoredMessage(ColorPurple, "shell [domain] [service]") + " - Open a shell in a project container (default: php)")
+	fmt.Println("  " + ColoredMessage(ColorPurple, "composer|artisan [domain] ...") + " - Run composer or artisan in the PHP container")
+	fmt.Println("  " + ColoredMessage(ColorPurple, "php [domain] xdebug on|off|profile|trace") + " - Switch Xdebug without a rebuild, php [domain] shows status")
+	fmt.Println("  " + ColoredMessage(ColorPurple, "php [domain] coverage pcov|xdebug|off") + " - Also: opcache on|off, blackfire on|off")
+	fmt.Println("  " + ColoredMessage(ColorPurple, "npm|yarn [domain] ...") + " - Run npm or yarn in the Node container")
+	fmt.Println("  " + ColoredMessage(ColorPurple, "db shell [domain] ...") + " - Open the database client (mysql, mariadb or psql)")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "route add [domain] [path] [service:port]") + " - Proxy a path to a service (--ws, --timeout, --max-body)")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "route rm|list [domain] [path]") + " - Remove or list proxy routes")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "expose [domain] [service:port]") + " - Serve a service on its own subdomain (--subdomain, --rm)")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "link [domain] [url]") + " - Proxy a local domain to an upstream outside domains/ (--no-ssl)")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "unlink [domain]") + " - Remove a linked domain")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "adopt [dir] --domain [domain] --service [service]") + " - Serve an existing compose stack through the proxy (--port 80, --no-ssl)")
+	fmt.Println("  " + ColoredMessage(ColorRed, "prune [--dry-run] [-y]") + " - Remove images, containers and files left by deleted projects")
+	fmt.Println("  " + ColoredMessage(ColorBlue, "db export [domain] [file]") + " - Dump the project database (.gz compresses)")
+	fmt.Println("  " + ColoredMessage(ColorBlue, "db import [domain] [file] [--reset]") + " - Load an .sql or .sql.gz file")
+	fmt.Println("  " + ColoredMessage(ColorBlue, "db snapshot save|restore|list [domain] [name]") + " - Manage named snapshots")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "secrets set|rm|list|migrate") + " - Manage the secret store (SECRETS_BACKEND=file|keyring)")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "templates export [dir]") + " - Copy the built-in templates for customising (--user, --force)")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "templates list") + "        - Show each template and where it is loaded from")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "templates lint") + "        - Render every template with sample data and report errors")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "upgrade [domain] [--dry-run]") + " - Merge template changes into a project, keeping local edits (--force)")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "upgrade --shared") + "      - Merge template changes into shared-services")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "config list|get|set|validate") + " - Manage settings of .env or ~/.config/dockdev (--user)")
+	fmt.Println("  " + ColoredMessage(ColorCyan, "-o KEY=VALUE [command]") + " - Override a setting for one run")
 	fmt.Println("  " + ColoredMessage(ColorCyan, "-H, --help") + "            - Show this help message")
 	fmt.Println("\n" + Bold("Examples:"))
 	fmt.Println("  " + ColoredMessage(ColorGreen, "myapp.test") + "            - Create a new project with domain myapp.test")
 	fmt.Println("  " + ColoredMessage(ColorRed, "rm myapp.test") + "         - Remove the project with domain myapp.test")
+	fmt.Println("  " + ColoredMessage(ColorYellow, "logs myapp.test php -f") + " - Follow PHP container output and PHP error log")
+	fmt.Println("  " + ColoredMessage(ColorPurple, "composer myapp.test install") + " - Install PHP dependencies as your user")
 
 	fmt.Println("\n" + Bold("Features:"))
 	fmt.Println("  • Interactive project creation and deletion")
 	fmt.Println("  • Automatic SSL certificate generation")
-	fmt.Println("  • Windows hosts file management")
+	fmt.Println("  • Hosts file management (Windows hosts in WSL, /etc/hosts on Linux)")
 	fmt.Println("  • Automatic browser opening for new projects")
-	fmt.Println("  • Shared MySQL database for all projects")
+	fmt.Println("  • Own database and user per project on shared MySQL, MariaDB or PostgreSQL (--db)")
 }
 
 // ListExistingProjects returns a list of existing project domains
@@ -119,6 +156,30 @@ func InteractiveProjectCreation() error {
 
 	useSSL := YesNoPrompt("Do you want to enable SSL for this project?", true)
 
+	engines, err := configuredEngines()
+	if err != nil {
+		return err
+	}
+	engine := StringPrompt(fmt.Sprintf("Database engine (%s) [%s]:", strings.Join(SupportedEngines, ", "), engines[0]))
+	if engine == "" {
+		engine = engines[0]
+	}
+	if _, err := databaseEngine(engine); err != nil {
+		return err
+	}
+
+	stack := defaultStack()
+	if version := StringPrompt(fmt.Sprintf("PHP version (%s) [%s]:", strings.Join(SupportedPHPVersions, ", "), stack.PHPVersion)); version != "" {
+		stack.PHPVersion = version
+	}
+	if version := StringPrompt(fmt.Sprintf("Node.js version [%s]:", stack.NodeVersion)); version != "" {
+		stack.NodeVersion = version
+	}
+	stack.PHPExtensions = ParsePHPExtensions(StringPrompt("Extra PHP extensions, comma separated (e.g. imagick,xdebug) []:"))
+	if err := stack.validate(); err != nil {
+		return err
+	}
+
 	if useSSL {
 		fmt.Println(Info("Creating project with SSL enabled..."))
 	} else {
@@ -131,7 +192,7 @@ func InteractiveProjectCreation() error {
 	fmt.Println(Bold("GENERATING PROJECT:"))
 
 	// GenerateProject will handle browser opening
-	return GenerateProject(domain, useSSL)
+	return GenerateProject(domain, ProjectOptions{UseSSL: useSSL, Engine: engine, Stack: stack})
 }
 
 // InteractiveProjectDeletion guides the user through deleting projects
@@ -0,0 +1,413 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+// configKind is the type a setting is validated as
+type configKind int
+
+const (
+	configString configKind = iota
+	configIP
+	configCIDR
+	configPassword
+	configEnum
+	configEngines
+	configDir
+)
+
+// configSetting describes one setting of .env or the user config
+type configSetting struct {
+	Key         string
+	Kind        configKind
+	Choices     []string       // allowed values of configEnum, "" meaning unset
+	Pattern     *regexp.Regexp // optional format of configString
+	Required    func() bool    // nil for optional settings
+	Description string
+}
+
+// always marks a setting every workspace needs
+func always() bool { return true }
+
+// engineEnabled marks a setting needed when the engine runs in shared-services
+func engineEnabled(engine string) func() bool {
+	return func() bool {
+		engines, err := configuredEngines()
+		return err == nil && slices.Contains(engines, engine)
+	}
+}
+
+var (
+	dockerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	dbUserPattern     = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,31}$`)
+)
+
+// configSchema lists every setting dockdev reads, in the order `config list` shows them
+var configSchema = []configSetting{
+	{Key: EnvDockdevHome, Kind: configDir, Description: "workspace root, found by walking up to " + WorkspaceMarker + " when empty"},
+	{Key: EnvNetworkName, Kind: configString, Pattern: dockerNamePattern, Required: always, Description: "Docker network shared by all projects"},
+	{Key: EnvSubnet, Kind: configCIDR, Description: "subnet of the network, the IPs below must lie inside it"},
+	{Key: EnvReverseProxyIP, Kind: configIP, Required: always, Description: "IP of the nginx reverse proxy"},
+	{Key: EnvProjectStartIP, Kind: configIP, Required: always, Description: "first IP handed out to project services"},
+	{Key: EnvSharedDBEngines, Kind: configEngines, Description: "shared database engines, the first is the default (mysql when empty)"},
+	{Key: EnvSharedMySQLIP, Kind: configIP, Required: engineEnabled(EngineMySQL), Description: "IP of the shared MySQL container"},
+	{Key: EnvSharedMariaDBIP, Kind: configIP, Required: engineEnabled(EngineMariaDB), Description: "IP of the shared MariaDB container"},
+	{Key: EnvSharedPostgresIP, Kind: configIP, Required: engineEnabled(EnginePostgres), Description: "IP of the shared PostgreSQL container"},
+	{Key: EnvMySQLRootPassword, Kind: configPassword, Required: engineEnabled(EngineMySQL), Description: "MySQL root password"},
+	{Key: EnvMySQLUser, Kind: configString, Pattern: dbUserPattern, Required: engineEnabled(EngineMySQL), Description: "MySQL application user"},
+	{Key: EnvMySQLPassword, Kind: configPassword, Required: engineEnabled(EngineMySQL), Description: "password of MYSQL_USER"},
+	{Key: EnvMariaDBRootPassword, Kind: configPassword, Description: "MariaDB root password, MYSQL_ROOT_PASSWORD when empty"},
+	{Key: EnvPostgresPassword, Kind: configPassword, Required: engineEnabled(EnginePostgres), Description: "PostgreSQL superuser password"},
+	{Key: EnvSecretsBackend, Kind: configEnum, Choices: []string{"", SecretsBackendEnv, SecretsBackendFile, SecretsBackendKeyring}, Description: "where credentials are kept"},
+	{Key: EnvSecretsPassphrase, Kind: configPassword, Description: "passphrase of the file secret backend, prompted when empty"},
+	{Key: EnvPlatform, Kind: configEnum, Choices: []string{"", "wsl", "linux"}, Description: "wsl or linux, detected when empty"},
+}
+
+// lookupSetting returns the schema entry of a key
+func lookupSetting(key string) (configSetting, bool) {
+	for _, setting := range configSchema {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return configSetting{}, false
+}
+
+var (
+	configOnce    sync.Once
+	configSources = map[string]string{} // key -> where its value came from
+)
+
+// workspaceConfigPath returns the .env of the workspace
+func workspaceConfigPath() string {
+	return WorkspaceConfigFile
+}
+
+// userConfigPath returns ~/.config/dockdev/config.env, or "" when there is no config dir
+func userConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, ConfigDirName, UserConfigFile)
+}
+
+// SetConfigOverride sets a value for this run, above every other source. It is
+// used for the -o KEY=VALUE flag.
+func SetConfigOverride(key, value string) {
+	os.Setenv(key, value)
+	configSources[key] = "flag"
+}
+
+// loadConfig loads the settings once. godotenv never replaces a value that is already
+// set, so loading from highest to lowest precedence gives: flags, the environment,
+// the workspace .env, then the user config. Missing files are skipped.
+func loadConfig() {
+	configOnce.Do(func() {
+		for _, path := range []string{workspaceConfigPath(), userConfigPath()} {
+			if path == "" {
+				continue
+			}
+			values, err := godotenv.Read(path)
+			if err != nil {
+				continue
+			}
+			for key, value := range values {
+				if _, ok := os.LookupEnv(key); !ok {
+					os.Setenv(key, value)
+					configSources[key] = path
+				}
+			}
+		}
+	})
+}
+
+// configOverride returns a value given with -o or set in the environment, which take
+// precedence over the secret store and the config files
+func configOverride(key string) (string, string, bool) {
+	value, source := os.Getenv(key), configSources[key]
+	if value == "" || (source != "" && source != "flag") {
+		return "", "", false
+	}
+	if source == "" {
+		source = "environment"
+	}
+	return value, source, true
+}
+
+// configValue returns a setting's value and where it came from. Passwords may live in
+// the secret store, between the environment and the config files.
+func configValue(setting configSetting) (string, string) {
+	if value, source, ok := configOverride(setting.Key); ok {
+		return value, source
+	}
+	if setting.Kind == configPassword && setting.Key != EnvSecretsPassphrase {
+		if store, err := secretStore(); err == nil && store != nil {
+			if value, err := store.Get(setting.Key); err == nil && value != "" {
+				return value, store.Name()
+			}
+		}
+	}
+	return os.Getenv(setting.Key), configSources[setting.Key]
+}
+
+// checkValue validates a value against the setting's type
+func checkValue(setting configSetting, value string) error {
+	if value == "" {
+		return nil
+	}
+	switch setting.Kind {
+	case configIP:
+		if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%q is not an IPv4 address", value)
+		}
+		if setting.Key == EnvProjectStartIP {
+			if last, _ := strconv.Atoi(value[strings.LastIndex(value, ".")+1:]); last >= 254 {
+				return fmt.Errorf("%q leaves no addresses for projects, use a lower last octet", value)
+			}
+		}
+	case configCIDR:
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return fmt.Errorf("%q is not a subnet such as 10.0.100.0/24", value)
+		}
+	case configEnum:
+		if !slices.Contains(setting.Choices, strings.ToLower(value)) {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(setting.Choices[1:], ", "))
+		}
+	case configEngines:
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(strings.ToLower(name)); name != "" && !slices.Contains(SupportedEngines, name) {
+				return fmt.Errorf("unknown database engine %q (supported: %s)", name, strings.Join(SupportedEngines, ", "))
+			}
+		}
+	case configDir:
+		if info, err := os.Stat(value); err != nil || !info.IsDir() {
+			return fmt.Errorf("%q is not a directory", value)
+		}
+	case configString:
+		if setting.Pattern != nil && !setting.Pattern.MatchString(value) {
+			return fmt.Errorf("%q has an invalid format", value)
+		}
+	}
+	return nil
+}
+
+// configProblem is a setting that is missing or invalid
+type configProblem struct {
+	Key     string
+	Message string
+}
+
+func (p configProblem) String() string {
+	return p.Key + ": " + p.Message
+}
+
+// configProblems checks every setting
+func configProblems() []configProblem {
+	loadConfig()
+
+	var problems []configProblem
+	for _, setting := range configSchema {
+		value, _ := configValue(setting)
+		if value == "" {
+			if setting.Required != nil && setting.Required() {
+				problems = append(problems, configProblem{setting.Key, "not set, " + setting.Description})
+			}
+			continue
+		}
+		if err := checkValue(setting, value); err != nil {
+			problems = append(problems, configProblem{setting.Key, err.Error()})
+		}
+	}
+
+	// The fixed addresses must lie in the subnet and must not be handed out to projects
+	if _, subnet, err := net.ParseCIDR(os.Getenv(EnvSubnet)); err == nil {
+		for _, setting := range configSchema {
+			if ip := net.ParseIP(os.Getenv(setting.Key)); setting.Kind == configIP && ip != nil && !subnet.Contains(ip) {
+				problems = append(problems, configProblem{setting.Key, fmt.Sprintf("%s is outside %s %s", ip, EnvSubnet, subnet)})
+			}
+		}
+	}
+	start := os.Getenv(EnvProjectStartIP)
+	for _, key := range []string{EnvReverseProxyIP, EnvSharedMySQLIP, EnvSharedMariaDBIP, EnvSharedPostgresIP} {
+		if value := os.Getenv(key); value != "" && value == start {
+			problems = append(problems, configProblem{key, fmt.Sprintf("%s is also %s", value, EnvProjectStartIP)})
+		}
+	}
+	return problems
+}
+
+// validateConfig returns an error listing every configuration problem
+func validateConfig() error {
+	problems := configProblems()
+	if len(problems) == 0 {
+		return nil
+	}
+	var lines []string
+	for _, problem := range problems {
+		lines = append(lines, problem.String())
+	}
+	return fmt.Errorf("invalid configuration, fix it with `dockdev config set` or in %s:\n  %s",
+		workspaceConfigPath(), strings.Join(lines, "\n  "))
+}
+
+// ConfigCommand implements `dockdev config get|set|list|validate`
+func ConfigCommand(args []string) error {
+	usage := fmt.Errorf("usage: config list | config get <KEY> | config set <KEY> <value> [--user] | config validate")
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 {
+		return usage
+	}
+	loadConfig()
+
+	switch parsed.Positional[0] {
+	case "list":
+		return listConfig()
+	case "validate":
+		if err := validateConfig(); err != nil {
+			return err
+		}
+		fmt.Println(Success("Configuration is valid."))
+		return nil
+	case "get":
+		if len(parsed.Positional) != 2 {
+			return usage
+		}
+		setting, ok := lookupSetting(parsed.Positional[1])
+		if !ok {
+			return fmt.Errorf("unknown setting %s, see `dockdev config list`", parsed.Positional[1])
+		}
+		value, _ := configValue(setting)
+		fmt.Println(value)
+		return nil
+	case "set":
+		if len(parsed.Positional) != 3 {
+			return usage
+		}
+		return setConfig(parsed.Positional[1], parsed.Positional[2], parsed.Has("user"))
+	}
+	return usage
+}
+
+// setConfig validates a value and writes it to the workspace .env or the user config
+func setConfig(key, value string, user bool) error {
+	setting, ok := lookupSetting(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %s, see `dockdev config list`", key)
+	}
+	if setting.Kind == configDir && value != "" {
+		// Stored absolute, a relative directory would depend on where dockdev runs
+		if abs, err := filepath.Abs(userPath(value)); err == nil {
+			value = abs
+		}
+	}
+	if err := checkValue(setting, value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if setting.Kind == configPassword && setting.Key != EnvSecretsPassphrase {
+		if store, err := secretStore(); err != nil {
+			return err
+		} else if store != nil {
+			return fmt.Errorf("%s is kept in the %s secret store, use `dockdev secrets set %s`", key, store.Name(), key)
+		}
+	}
+
+	path := workspaceConfigPath()
+	if user {
+		if path = userConfigPath(); path == "" {
+			return fmt.Errorf("no user config directory")
+		}
+		if err := CreateDirIfNotExist(filepath.Dir(path)); err != nil {
+			return err
+		}
+	}
+	if err := upsertEnvFile(path, []EnvValue{{Key: key, Value: value}}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if setting.Kind == configPassword {
+		_ = os.Chmod(path, 0600)
+	}
+	fmt.Println(Success("Set"), Bold(key), Success("in"), Info(path))
+
+	// A higher source still wins over the file just written
+	if _, source := configValue(setting); source == "flag" || source == "environment" || (user && source == workspaceConfigPath()) {
+		fmt.Println(Warning(fmt.Sprintf("Note: %s is also set in %s, which takes precedence.", key, source)))
+	}
+	return nil
+}
+
+// listConfig prints every setting with its value and source. Passwords are masked.
+func listConfig() error {
+	fmt.Println(Bold("Configuration") + Gray(" (flags > environment > "+workspaceConfigPath()+" > "+userConfigPath()+")"))
+	invalid := map[string]bool{}
+	problems := configProblems()
+	for _, problem := range problems {
+		invalid[problem.Key] = true
+	}
+	for _, setting := range configSchema {
+		value, source := configValue(setting)
+		shown := fmt.Sprintf("%-20s", value)
+		switch {
+		case value == "":
+			shown = Gray(fmt.Sprintf("%-20s", "(unset)"))
+		case setting.Kind == configPassword:
+			shown = fmt.Sprintf("%-20s", "********")
+		}
+		status := ""
+		if invalid[setting.Key] {
+			status = Error(" ✗")
+		}
+		fmt.Printf("  %-27s %s %s%s\n", setting.Key, shown, Gray(source), status)
+		fmt.Printf("  %-27s %s\n", "", Gray(setting.Description))
+	}
+	if len(problems) > 0 {
+		fmt.Println()
+		return validateConfig()
+	}
+	return nil
+}
+
+// ApplyConfigOverrides applies the -o KEY=VALUE (or --option) flags that come before
+// the command and returns the arguments without them
+func ApplyConfigOverrides(args []string) ([]string, error) {
+	rest := []string{args[0]}
+	i := 1
+	for ; i < len(args); i++ {
+		assignment, ok := strings.CutPrefix(args[i], "--option=")
+		if !ok {
+			if args[i] != "-o" && args[i] != "--option" {
+				break
+			}
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag %s requires KEY=VALUE", args[i])
+			}
+			i++
+			assignment = args[i]
+		}
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid option %q, use KEY=VALUE", assignment)
+		}
+		if setting, known := lookupSetting(key); known {
+			if err := checkValue(setting, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		SetConfigOverride(key, value)
+	}
+	return append(rest, args[i:]...), nil
+}
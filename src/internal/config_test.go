@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// mapSecretStore is a secret store kept in memory
+type mapSecretStore map[string]string
+
+func (s mapSecretStore) Name() string                   { return "test store" }
+func (s mapSecretStore) Get(key string) (string, error) { return s[key], nil }
+func (s mapSecretStore) Set(key, value string) error    { s[key] = value; return nil }
+func (s mapSecretStore) Delete(key string) error        { delete(s, key); return nil }
+
+// useSecretStore makes secretStore return store for the rest of the test
+func useSecretStore(t *testing.T, store SecretStore) {
+	t.Helper()
+	previous := cachedSecretStore
+	cachedSecretStore = store
+	t.Cleanup(func() { cachedSecretStore = previous })
+}
+
+// setConfigSource sets a config value as if it was read from source, "" for the environment
+func setConfigSource(t *testing.T, key, value, source string) {
+	t.Helper()
+	t.Setenv(key, value)
+	previous, had := configSources[key]
+	if source == "" {
+		delete(configSources, key)
+	} else {
+		configSources[key] = source
+	}
+	t.Cleanup(func() {
+		if had {
+			configSources[key] = previous
+		} else {
+			delete(configSources, key)
+		}
+	})
+}
+
+func TestConfigValuePrecedence(t *testing.T) {
+	password, _ := lookupSetting(EnvMySQLPassword)
+	user, _ := lookupSetting(EnvMySQLUser)
+
+	tests := []struct {
+		name       string
+		setting    configSetting
+		value      string // "" leaves the key unset
+		source     string // "flag", "" for the environment, or a config file
+		stored     string // value in the secret store
+		want       string
+		wantSource string
+	}{
+		{name: "flag over store", setting: password, value: "from-flag", source: "flag", stored: "from-store", want: "from-flag", wantSource: "flag"},
+		{name: "environment over store", setting: password, value: "from-env", stored: "from-store", want: "from-env", wantSource: "environment"},
+		{name: "store over workspace file", setting: password, value: "from-file", source: ".env", stored: "from-store", want: "from-store", wantSource: "test store"},
+		{name: "store over nothing", setting: password, stored: "from-store", want: "from-store", wantSource: "test store"},
+		{name: "file without stored value", setting: password, value: "from-file", source: ".env", want: "from-file", wantSource: ".env"},
+		{name: "store ignored for other settings", setting: user, value: "from-file", source: ".env", stored: "from-store", want: "from-file", wantSource: ".env"},
+		{name: "unset", setting: password, want: "", wantSource: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := mapSecretStore{}
+			if tt.stored != "" {
+				store[tt.setting.Key] = tt.stored
+			}
+			useSecretStore(t, store)
+			setConfigSource(t, tt.setting.Key, tt.value, tt.source)
+
+			value, source := configValue(tt.setting)
+			if value != tt.want || source != tt.wantSource {
+				t.Errorf("configValue = %q from %q, want %q from %q", value, source, tt.want, tt.wantSource)
+			}
+			if tt.setting.Kind == configPassword {
+				if got := rootSecret(tt.setting.Key); got != tt.want {
+					t.Errorf("rootSecret = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{key: EnvReverseProxyIP, value: "", ok: true},
+		{key: EnvReverseProxyIP, value: "10.0.100.2", ok: true},
+		{key: EnvReverseProxyIP, value: "10.0.100"},
+		{key: EnvReverseProxyIP, value: "::1"},
+		{key: EnvReverseProxyIP, value: "localhost"},
+		{key: EnvProjectStartIP, value: "10.0.100.253", ok: true},
+		{key: EnvProjectStartIP, value: "10.0.100.254"},
+		{key: EnvSubnet, value: "10.0.100.0/24", ok: true},
+		{key: EnvSubnet, value: "10.0.100.0"},
+		{key: EnvSubnet, value: "10.0.100.0/33"},
+		{key: EnvPlatform, value: "wsl", ok: true},
+		{key: EnvPlatform, value: "WSL", ok: true},
+		{key: EnvPlatform, value: "windows"},
+		{key: EnvSecretsBackend, value: "keyring", ok: true},
+		{key: EnvSecretsBackend, value: "vault"},
+		{key: EnvSharedDBEngines, value: "mysql, postgres", ok: true},
+		{key: EnvSharedDBEngines, value: "MariaDB,,", ok: true},
+		{key: EnvSharedDBEngines, value: "mysql,oracle"},
+		{key: EnvNetworkName, value: "dockdev_net-1", ok: true},
+		{key: EnvNetworkName, value: "-dockdev"},
+		{key: EnvNetworkName, value: "dock dev"},
+		{key: EnvMySQLUser, value: "app_user", ok: true},
+		{key: EnvMySQLUser, value: "1user"},
+		{key: EnvMySQLUser, value: strings.Repeat("u", 33)},
+		{key: EnvDockdevHome, value: "/does/not/exist"},
+	}
+	for _, tt := range tests {
+		setting, ok := lookupSetting(tt.key)
+		if !ok {
+			t.Fatalf("unknown setting %s", tt.key)
+		}
+		if err := checkValue(setting, tt.value); (err == nil) != tt.ok {
+			t.Errorf("checkValue(%s, %q) = %v, want ok %v", tt.key, tt.value, err, tt.ok)
+		}
+	}
+	home, _ := lookupSetting(EnvDockdevHome)
+	if err := checkValue(home, t.TempDir()); err != nil {
+		t.Errorf("checkValue(%s, existing directory) = %v", EnvDockdevHome, err)
+	}
+}
+
+func TestConfigProblems(t *testing.T) {
+	// No workspace or user config files, only the values below
+	useBuiltinTemplates(t)
+	useSecretStore(t, nil)
+
+	valid := map[string]string{
+		EnvNetworkName:         "dockdev",
+		EnvSubnet:              "10.0.100.0/24",
+		EnvReverseProxyIP:      "10.0.100.2",
+		EnvProjectStartIP:      "10.0.100.10",
+		EnvSharedDBEngines:     "postgres",
+		EnvSharedPostgresIP:    "10.0.100.5",
+		EnvPostgresPassword:    "secret",
+		EnvSharedMySQLIP:       "",
+		EnvSharedMariaDBIP:     "",
+		EnvMySQLRootPassword:   "",
+		EnvMySQLUser:           "",
+		EnvMySQLPassword:       "",
+		EnvMariaDBRootPassword: "",
+		EnvSecretsBackend:      "",
+		EnvPlatform:            "",
+		EnvDockdevHome:         "",
+	}
+
+	tests := []struct {
+		name    string
+		changes map[string]string
+		want    []string // keys with a problem, in order
+	}{
+		{name: "valid"},
+		{name: "missing required", changes: map[string]string{EnvNetworkName: ""}, want: []string{EnvNetworkName}},
+		{name: "required by an engine", changes: map[string]string{EnvSharedDBEngines: "postgres,mysql", EnvSharedMySQLIP: "10.0.100.3"}, want: []string{EnvMySQLRootPassword, EnvMySQLUser, EnvMySQLPassword}},
+		{name: "proxy outside the subnet", changes: map[string]string{EnvReverseProxyIP: "10.0.200.2"}, want: []string{EnvReverseProxyIP}},
+		{name: "start outside the subnet", changes: map[string]string{EnvProjectStartIP: "192.168.1.10"}, want: []string{EnvProjectStartIP}},
+		{name: "no subnet, no containment check", changes: map[string]string{EnvSubnet: "", EnvReverseProxyIP: "10.0.200.2"}},
+		{name: "proxy on the start IP", changes: map[string]string{EnvReverseProxyIP: "10.0.100.10"}, want: []string{EnvReverseProxyIP}},
+		{name: "database on the start IP", changes: map[string]string{EnvSharedPostgresIP: "10.0.100.10"}, want: []string{EnvSharedPostgresIP}},
+		{name: "invalid value", changes: map[string]string{EnvSubnet: "10.0.100.0/40"}, want: []string{EnvSubnet}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range valid {
+				setConfigSource(t, key, value, "")
+			}
+			for key, value := range tt.changes {
+				setConfigSource(t, key, value, "")
+			}
+
+			var got []string
+			for _, problem := range configProblems() {
+				got = append(got, problem.Key)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("problems with %v, want %v", configProblems(), tt.want)
+			}
+		})
+	}
+}
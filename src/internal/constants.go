@@ -1,18 +1,39 @@
 package internal
 
+import "time"
+
 // File paths
 const (
 	IPMapPath           = ".ipmap.env"
-	TemplateDir         = "templates"
+	TemplateDir         = "templates" // workspace overrides, also under ~/.config/dockdev
 	ProjectDirPrefix    = "domains"
 	WindowsHostsPath    = "/mnt/c/Windows/System32/drivers/etc/hosts"
+	LinuxHostsPath      = "/etc/hosts"
+	BackupsDir          = "backups"
+	SnapshotsDir        = "snapshots"
 	SharedServicesDir   = "shared-services"
+	SharedSecretsDir    = "secrets"     // inside shared-services, mounted by compose as /run/secrets
+	SecretsFile         = "secrets.enc" // encrypted secret store of SECRETS_BACKEND=file
+	LinksFile           = "links.json"  // inside shared-services, domains routed to upstreams outside domains/
+	ConfigDirName       = "dockdev"     // inside the user config directory
+	PHPModesDir         = "dockdev.d"   // inside a project's conf/php, ini files written by `dockdev php`
+	WorkspaceConfigFile = ".env"
+	UserConfigFile      = "config.env"         // inside the user config directory, below the workspace .env
+	WorkspaceMarker     = ".dockdev-workspace" // marks the workspace root, see workspace.go
 )
 
 // Docker container names
 const (
-	ReverseProxyName = "nginx-reverse-proxy"
-	SharedMySQLName  = "shared_mysql"
+	ReverseProxyName   = "nginx-reverse-proxy"
+	SharedMySQLName    = "shared_mysql"
+	SharedMariaDBName  = "shared_mariadb"
+	SharedPostgresName = "shared_postgres"
+)
+
+// Compose project names
+const (
+	ComposeProjectPrefix = "dockdev_"       // followed by the project prefix, e.g. dockdev_app_test
+	SharedComposeProject = "dockdev_shared" // project name of shared-services
 )
 
 // Directory structure
@@ -21,20 +42,45 @@ const (
 	SitesDir          = "sites"
 	NginxConfFileName = "nginx.conf"
 	DockerComposeFile = "docker-compose.yml"
+	ProjectStateDir   = ".dockdev"
+	ProjectStateFile  = "state.json"
+	UpgradeBaseDir    = "base"                       // inside .dockdev, the files as last rendered from the templates
+	TemplateManifest  = "manifest.env"               // in a template layer, declares the template variables and their defaults
+	AdoptOverrideFile = "docker-compose.dockdev.yml" // in the project directory of an adopted compose stack
 )
 
 // Project structure folders
 var ProjectFolders = []string{"image", "conf", "logs", "data"}
 
+// Container exec defaults
+const (
+	AppDirInContainer   = "/var/www/html"
+	DefaultShellService = "php"
+)
+
+// AppServices work on the mounted app folder and run commands as the mapped host user
+var AppServices = []string{"php", "node"}
+
 // Environment variable names
 const (
-	EnvNetworkName       = "NETWORK_NAME"
-	EnvProjectStartIP    = "PROJECT_START_IP"
-	EnvSharedMySQLIP     = "SHARED_MYSQL_IP"
-	EnvReverseProxyIP    = "REVERSE_PROXY_IP"
-	EnvMySQLRootPassword = "MYSQL_ROOT_PASSWORD"
-	EnvMySQLUser         = "MYSQL_USER"
-	EnvMySQLPassword     = "MYSQL_PASSWORD"
+	EnvNetworkName         = "NETWORK_NAME"
+	EnvSubnet              = "SUBNET"
+	EnvDockdevHome         = "DOCKDEV_HOME"
+	EnvProjectStartIP      = "PROJECT_START_IP"
+	EnvSharedMySQLIP       = "SHARED_MYSQL_IP"
+	EnvReverseProxyIP      = "REVERSE_PROXY_IP"
+	EnvMySQLRootPassword   = "MYSQL_ROOT_PASSWORD"
+	EnvMySQLUser           = "MYSQL_USER"
+	EnvMySQLPassword       = "MYSQL_PASSWORD"
+	EnvSharedDBEngines     = "SHARED_DB_ENGINES"
+	EnvSharedMariaDBIP     = "SHARED_MARIADB_IP"
+	EnvSharedPostgresIP    = "SHARED_POSTGRES_IP"
+	EnvMariaDBRootPassword = "MARIADB_ROOT_PASSWORD"
+	EnvPostgresPassword    = "POSTGRES_PASSWORD"
+	EnvPlatform            = "PLATFORM"
+	EnvSecretsBackend      = "SECRETS_BACKEND"
+	EnvSecretsPassphrase   = "DOCKDEV_SECRETS_PASSPHRASE"
+	EnvTemplateVarPrefix   = "TEMPLATE_VAR_" // followed by a template variable name, e.g. TEMPLATE_VAR_php_memory
 )
 
 // Reserved IP suffixes
@@ -45,6 +91,40 @@ const (
 	ReservedIPBroadcast2 = 255 // Broadcast address
 )
 
+// Readiness checks after project creation
+const (
+	ReadinessTimeout      = 5 * time.Minute // composer/npm install on first start can take a while
+	ReadinessPollInterval = 2 * time.Second
+	ReadinessLogLines     = 20 // container log lines shown for services that are not ready
+)
+
+// Logs command defaults
+const (
+	DefaultLogTail      = 100               // lines shown per container or file
+	LogFileTailWindow   = 256 * 1024        // bytes read from the end of a log file to find the tail
+	LogFilePollInterval = 500 * time.Millisecond
+)
+
+// Project database settings
+const (
+	DatabasePasswordLength = 24
+	DatabasePort           = "3306"
+	PostgresPort           = "5432"
+	ProgressInterval       = 250 * time.Millisecond // how often dump/import progress is refreshed
+)
+
+// Versions of the project images, changed per project with --php/--node or `dockdev set`
+const (
+	DefaultPHPVersion  = "8.3"
+	DefaultNodeVersion = "23"
+)
+
+// Secret store settings
+const (
+	KeyringService       = "dockdev" // service attribute of keyring entries
+	SecretsKDFIterations = 600000    // PBKDF2-SHA256 rounds for the secrets file key
+)
+
 // Feature flags
 const (
 	// SSLEnabled controls whether SSL is enabled for projects
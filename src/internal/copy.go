@@ -23,6 +23,13 @@ func CopyDir(src, dst string) error {
 		if info.IsDir() {
 			return os.MkdirAll(target, info.Mode())
 		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
 
 		srcFile, err := os.Open(path)
 		if err != nil {
@@ -90,15 +97,14 @@ func CopyCertificates(crtPath, keyPath, dstDir string) error {
 	return nil
 }
 
-// CopyTemplatedDirectories copies directories from template to project directory
-func CopyTemplatedDirectories(templateDir, projectDir string, folders []string) error {
+// CopyTemplatedDirectories copies directories from the templates to the project directory
+func CopyTemplatedDirectories(projectDir string, folders []string) error {
 	for _, dir := range folders {
-		src := filepath.Join(templateDir, dir)
 		dst := filepath.Join(projectDir, dir)
 		
 		// Check if source directory exists
-		if _, err := os.Stat(src); err == nil {
-			if err := CopyDir(src, dst); err != nil {
+		if templateExists(dir) {
+			if err := copyTemplateDir(dir, dst); err != nil {
 				return fmt.Errorf("failed to copy %s: %w", dir, err)
 			}
 		}
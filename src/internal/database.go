@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progress reports transferred bytes on stderr while a dump or import is running
+type progress struct {
+	mu      sync.Mutex
+	label   string
+	total   int64 // 0 when unknown
+	current int64
+	last    time.Time
+}
+
+func newProgress(label string, total int64) *progress {
+	return &progress{label: label, total: total}
+}
+
+func (p *progress) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current += int64(n)
+	if time.Since(p.last) >= ProgressInterval {
+		p.last = time.Now()
+		p.print()
+	}
+}
+
+func (p *progress) print() {
+	if p.total > 0 {
+		fmt.Fprintf(os.Stderr, "\r%s %s / %s (%d%%)   ", p.label, formatBytes(p.current), formatBytes(p.total), p.current*100/p.total)
+	} else {
+		fmt.Fprintf(os.Stderr, "\r%s %s   ", p.label, formatBytes(p.current))
+	}
+}
+
+// done prints the final state and ends the progress line
+func (p *progress) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.print()
+	fmt.Fprintln(os.Stderr)
+}
+
+type progressWriter struct {
+	w io.Writer
+	p *progress
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.add(n)
+	return n, err
+}
+
+// DbCommand implements `dockdev db shell|export|import|snapshot ...`
+func DbCommand(args []string) error {
+	usage := fmt.Errorf("usage: db shell <domain> [arguments...] | db export <domain> [file] | db import <domain> <file.sql[.gz]> [--reset] | db snapshot save|restore|list <domain> [name]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "shell":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: db shell <domain> [arguments...]")
+		}
+		return openDatabaseClient(args[1], args[2:])
+	case "export":
+		return dbExportCommand(args[1:])
+	case "import":
+		return dbImportCommand(args[1:])
+	case "snapshot":
+		return dbSnapshotCommand(args[1:])
+	}
+	return usage
+}
+
+// projectDatabase loads the project state and returns its database
+func projectDatabase(domain string) (*ProjectState, error) {
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return nil, err
+	}
+	if state.Database == nil {
+		return nil, fmt.Errorf("project %s has no database of its own (created before per-project databases)", domain)
+	}
+	if err := CheckDockerRunning(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func dbExportCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 {
+		return fmt.Errorf("usage: db export <domain> [file]")
+	}
+
+	domain := parsed.Positional[0]
+	file := fmt.Sprintf("%s-%s.sql.gz", domain, time.Now().Format("20060102-150405"))
+	if len(parsed.Positional) > 1 {
+		file = parsed.Positional[1]
+	}
+	file = userPath(file)
+
+	state, err := projectDatabase(domain)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(Highlight("Exporting database"), Bold(state.Database.Name), Highlight("to"), Info(file))
+	if err := exportDatabaseToFile(state.Database, file); err != nil {
+		return err
+	}
+	fmt.Println(Success("Database exported:"), Info(file))
+	return nil
+}
+
+func dbImportCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) < 2 {
+		return fmt.Errorf("usage: db import <domain> <file.sql[.gz]> [--reset]")
+	}
+
+	domain, file := parsed.Positional[0], userPath(parsed.Positional[1])
+	state, err := projectDatabase(domain)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Has("reset") {
+		fmt.Println(Highlight("Resetting database"), Bold(state.Database.Name), Highlight("..."))
+		if err := resetProjectDatabase(state.Database); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(Highlight("Importing"), Info(file), Highlight("into"), Bold(state.Database.Name))
+	if err := importDatabaseFromFile(state.Database, file); err != nil {
+		return err
+	}
+	fmt.Println(Success("Database imported."))
+	return nil
+}
+
+func dbSnapshotCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	usage := fmt.Errorf("usage: db snapshot save|restore|list <domain> [name] [-y]")
+	if len(parsed.Positional) < 2 {
+		return usage
+	}
+
+	action, domain := parsed.Positional[0], parsed.Positional[1]
+	dir := filepath.Join(SnapshotsDir, domain)
+
+	if action == "list" {
+		return listSnapshots(dir)
+	}
+	if len(parsed.Positional) < 3 {
+		return usage
+	}
+
+	name := parsed.Positional[2]
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid snapshot name: %s", name)
+	}
+	path := filepath.Join(dir, name+".sql.gz")
+
+	state, err := projectDatabase(domain)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "save":
+		if err := CreateDirIfNotExist(dir); err != nil {
+			return err
+		}
+		fmt.Println(Highlight("Saving snapshot"), Bold(name), Highlight("of"), Bold(state.Database.Name))
+		if err := exportDatabaseToFile(state.Database, path); err != nil {
+			return err
+		}
+		fmt.Println(Success("Snapshot saved:"), Info(path))
+		return nil
+
+	case "restore":
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("snapshot %s not found for %s", name, domain)
+		}
+		if !parsed.Has("y") && IsTerminal() &&
+			!YesNoPrompt(fmt.Sprintf("Replace all data in '%s' with snapshot '%s'?", state.Database.Name, name), false) {
+			fmt.Println(Info("Aborted."))
+			return nil
+		}
+
+		fmt.Println(Highlight("Restoring snapshot"), Bold(name), Highlight("into"), Bold(state.Database.Name))
+		if err := resetProjectDatabase(state.Database); err != nil {
+			return err
+		}
+		if err := importDatabaseFromFile(state.Database, path); err != nil {
+			return err
+		}
+		fmt.Println(Success("Snapshot restored."))
+		return nil
+	}
+	return usage
+}
+
+// listSnapshots prints the snapshots stored in dir, newest first
+func listSnapshots(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var infos []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql.gz") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) == 0 {
+		fmt.Println(Info("No snapshots found."))
+		return nil
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().After(infos[j].ModTime()) })
+	fmt.Println(Bold("Snapshots:"))
+	for _, info := range infos {
+		fmt.Printf("  %-30s %s  %s\n", strings.TrimSuffix(info.Name(), ".sql.gz"),
+			Gray(info.ModTime().Format("2006-01-02 15:04:05")), Gray(formatBytes(info.Size())))
+	}
+	return nil
+}
+
+// exportDatabaseToFile dumps a project database to path, gzip compressed when path ends in .gz
+func exportDatabaseToFile(db *DatabaseState, path string) error {
+	engine, err := projectEngine(db)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p := newProgress("Exported", 0)
+	var out io.Writer = &progressWriter{w: file, p: p}
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(out)
+		out = gz
+	}
+
+	err = engine.Dump(db, out)
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	p.done()
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// importDatabaseFromFile loads an SQL file, optionally gzip compressed, into a project database
+func importDatabaseFromFile(db *DatabaseState, path string) error {
+	engine, err := projectEngine(db)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	p := newProgress("Imported", info.Size())
+	var in io.Reader = &progressReader{r: file, p: p}
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	err = engine.Restore(db, in)
+	p.done()
+	return err
+}
+
+// resetProjectDatabase drops and recreates the project database, keeping its user
+func resetProjectDatabase(db *DatabaseState) error {
+	engine, err := projectEngine(db)
+	if err != nil {
+		return err
+	}
+	return engine.Reset(db)
+}
@@ -8,7 +8,10 @@ import (
     "strings"
 )
 
-func DeleteProject(domain string) {
+// DeleteProject removes a project and everything dockdev created for it. The optional
+// backup parameter decides whether the project database is dumped before it is dropped;
+// without it the user is asked in interactive mode.
+func DeleteProject(domain string, backup ...bool) {
 	PrintSectionDivider("DELETING PROJECT: " + domain)
 
 	if IsTerminal() {
@@ -22,15 +25,36 @@ func DeleteProject(domain string) {
 		fmt.Printf(Info("Deleting domain '%s'...\n"), Bold(domain))
 	}
 
+	// Host names of exposed services are only known from the state, which goes away with the files
+	hosts := []string{domain}
+	var adopted *ProjectState
+	if state, err := LoadProjectState(domain); err == nil {
+		hosts = append(hosts, exposedHosts(state)...)
+		if state.Adopted != nil {
+			adopted = state
+		}
+	}
+
 	// Ensure Docker is running if we need to stop containers
 	projectPath := filepath.Join(ProjectDirPrefix, domain)
-	composeFile := filepath.Join(projectPath, DockerComposeFile)
 	
 	PrintDivider()
 	fmt.Println(Bold("STEP 1: Stopping containers"))
 	
-	// Stop containers if the project exists
-	if _, err := os.Stat(composeFile); err == nil {
+	// Stop containers if the project exists. An adopted stack is only detached, it isn't ours.
+	if adopted != nil {
+		if err := EnsureDockerRunning(); err != nil {
+			fmt.Printf(Warning("Warning: Docker is not available: %v\n"), err)
+			fmt.Println(Info("The stack in"), Info(adopted.Adopted.Dir), Info("stays attached until its containers are recreated."))
+		} else {
+			fmt.Println(Highlight("Detaching"), Bold(adopted.Adopted.Service), Highlight("of the stack in"), Info(adopted.Adopted.Dir), Highlight("..."))
+			if err := detachAdoptedStack(adopted); err != nil {
+				fmt.Println(Warning("Warning:"), Error(err.Error()))
+			} else {
+				fmt.Println(Success("Detached, the stack keeps running."))
+			}
+		}
+	} else if hasComposeStack(projectPath) {
 		// Check if Docker is running before trying to stop containers
 		if err := EnsureDockerRunning(); err != nil {
 			fmt.Printf(Warning("Warning: Docker is not available: %v\n"), err)
@@ -48,7 +72,12 @@ func DeleteProject(domain string) {
 	}
 
 	PrintDivider()
-	fmt.Println(Bold("STEP 2: Removing project files"))
+	fmt.Println(Bold("STEP 2: Removing project database"))
+
+	removeProjectDatabase(domain, backup...)
+
+	PrintDivider()
+	fmt.Println(Bold("STEP 3: Removing project files"))
 	
 	err := os.RemoveAll(projectPath)
 	if err != nil {
@@ -68,7 +97,7 @@ func DeleteProject(domain string) {
 	}
 
 	PrintDivider()
-	fmt.Println(Bold("STEP 3: Removing SSL certificates"))
+	fmt.Println(Bold("STEP 4: Removing SSL certificates"))
 	
 	certDir := filepath.Join(CertsDir, domain)
 	if err := os.RemoveAll(certDir); err == nil {
@@ -77,45 +106,6 @@ func DeleteProject(domain string) {
 		fmt.Println(Error("Failed to delete cert folder:"), Error(err.Error()))
 	}
 
-	PrintDivider()
-	fmt.Println(Bold("STEP 4: Removing Windows certificates"))
-	
-	// Use -NoProfile and -ExecutionPolicy Bypass for more efficient PowerShell execution
-	checkCmd := exec.Command("powershell.exe", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command",
-		fmt.Sprintf(`certutil -store Root ^| Select-String "%s"; exit`, domain))
-
-	output, err := checkCmd.CombinedOutput()
-	// Force garbage collection for PowerShell process
-	if checkCmd.Process != nil {
-		checkCmd.Process.Kill()
-	}
-	
-	if err != nil {
-		fmt.Printf(Warning("Warning: failed to check Windows cert store: %v\n"), err)
-	} else if strings.Contains(string(output), domain) {
-		fmt.Println(Highlight("Removing domain cert from Windows Root store..."))
-
-		delCmd := exec.Command("powershell.exe", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command",
-			fmt.Sprintf(`Start-Process powershell -Verb runAs -ArgumentList '-NoProfile','-ExecutionPolicy','Bypass','-Command','certutil -delstore Root "%s"; exit'`, domain))
-		delCmd.Stdin = os.Stdin
-		delCmd.Stdout = os.Stdout
-		delCmd.Stderr = os.Stderr
-
-		err := delCmd.Run()
-		// Force garbage collection for PowerShell process
-		if delCmd.Process != nil {
-			delCmd.Process.Kill()
-		}
-		
-		if err != nil {
-			fmt.Println(Error("Failed to remove trusted cert:"), Error(err.Error()))
-		} else {
-			fmt.Println(Success("Removed domain cert from Windows Root store."))
-		}
-	} else {
-		fmt.Println(Info("Domain cert not found in Windows Root store — skipping removal."))
-	}
-
 	PrintDivider()
 	fmt.Println(Bold("STEP 5: Updating configuration files"))
 	
@@ -138,9 +128,11 @@ func DeleteProject(domain string) {
 		siteConfigRemoved = true
 	}
 
-	// Remove domain from Windows hosts file
-	if err := removeFromWindowsHosts(domain, WindowsHostsPath); err != nil {
-		fmt.Println(Warning("Warning: failed to update Windows hosts file:"), Error(err.Error()))
+	// Remove domain and exposed subdomains from the hosts file
+	for _, host := range hosts {
+		if err := CurrentPlatform().RemoveHostsEntry(host); err != nil {
+			fmt.Println(Warning("Warning: failed to update hosts file:"), Error(err.Error()))
+		}
 	}
 
 	PrintDivider()
@@ -161,3 +153,55 @@ func DeleteProject(domain string) {
 	PrintSectionDivider("OPERATION COMPLETE")
 	fmt.Println(Success("Domain"), Bold(domain), Success("was successfully deleted."))
 }
+
+
+// removeProjectDatabase drops the project schema and user, optionally after a backup.
+// The database is kept if the backup fails.
+func removeProjectDatabase(domain string, backup ...bool) {
+	state, err := LoadProjectState(domain)
+	if err != nil || state.Database == nil {
+		fmt.Println(Info("No project database recorded, skipping."))
+		return
+	}
+
+	if err := CheckDockerRunning(); err != nil {
+		fmt.Println(Warning("Warning: Docker is not available, database"), Bold(state.Database.Name), Warning("was kept."))
+		return
+	}
+
+	engine, err := projectEngine(state.Database)
+	if err != nil {
+		fmt.Println(Warning("Warning:"), Error(err.Error()))
+		return
+	}
+
+	doBackup := false
+	if len(backup) > 0 {
+		doBackup = backup[0]
+	} else if IsTerminal() {
+		doBackup = YesNoPrompt(fmt.Sprintf("Back up database '%s' before dropping it?", state.Database.Name), true)
+	}
+
+	if doBackup {
+		fmt.Println(Highlight("Backing up database"), Bold(state.Database.Name), Highlight("..."))
+		path, err := backupProjectDatabase(domain, state.Database)
+		if err != nil {
+			fmt.Println(Error("Backup failed:"), Error(err.Error()))
+			fmt.Println(Warning("Database"), Bold(state.Database.Name), Warning("was kept."))
+			return
+		}
+		fmt.Println(Success("Database backup written to:"), Info(path))
+	}
+
+	if err := engine.Drop(state.Database); err != nil {
+		fmt.Println(Warning("Warning: failed to drop database:"), Error(err.Error()))
+		return
+	}
+	fmt.Println(Success("Dropped database and user:"), Info(state.Database.Name))
+
+	if store, err := secretStore(); err == nil && store != nil {
+		if err := store.Delete(projectSecretKey(domain)); err != nil {
+			fmt.Println(Warning("Warning: failed to remove the stored database password:"), Error(err.Error()))
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
     "fmt"
     "os"
     "os/exec"
+    "path/filepath"
     "time"
     "strings"
 )
@@ -25,29 +26,8 @@ func CheckDockerRunning() error {
     return nil
 }
 
-// StartDockerDesktop attempts to start Docker Desktop on Windows
-func StartDockerDesktop() error {
-    PrintSectionDivider("STARTING DOCKER DESKTOP")
-    fmt.Println(Highlight("Attempting to start Docker Desktop..."))
-    
-    // Path to Docker Desktop on Windows
-    dockerPath := "C:\\Program Files\\Docker\\Docker\\Docker Desktop.exe"
-    
-    // Check if Docker Desktop exists at the expected path
-    if _, err := os.Stat("/mnt/c/Program Files/Docker/Docker/Docker Desktop.exe"); os.IsNotExist(err) {
-        return fmt.Errorf("Docker Desktop not found at expected location")
-    }
-    
-    // Start Docker Desktop
-    cmd := exec.Command("cmd.exe", "/c", "start", `"Docker Desktop"`, dockerPath)
-    if err := cmd.Run(); err != nil {
-        return fmt.Errorf("failed to start Docker Desktop: %w", err)
-    }
-    
-    PrintDivider()
-    fmt.Println(Info("Docker Desktop is starting. Please wait..."))
-    
-    // Wait for Docker to become available
+// waitForDockerDaemon polls until the Docker daemon accepts commands
+func waitForDockerDaemon() error {
     maxAttempts := 30
     for i := 0; i < maxAttempts; i++ {
         time.Sleep(2 * time.Second)
@@ -72,8 +52,8 @@ func EnsureDockerRunning() error {
     fmt.Println(Warning("Docker is not running."))
     
     if IsTerminal() {
-        if YesNoPrompt("Would you like to start Docker Desktop?", true) {
-            return StartDockerDesktop()
+        if YesNoPrompt("Would you like to start Docker?", true) {
+            return CurrentPlatform().StartDocker()
         } else {
             return fmt.Errorf("Docker is required but not running. Operation cancelled")
         }
@@ -82,13 +62,31 @@ func EnsureDockerRunning() error {
     }
 }
 
+// composeCommand returns `docker compose <args>` for the stack in dir. An adopted stack
+// runs from its own directory, with the dockdev override in dir added to its files.
+func composeCommand(dir string, args ...string) *exec.Cmd {
+	if state := adoptedState(dir); state != nil {
+		return exec.Command("docker", append(state.Adopted.composeArgs(dir, state.ComposeProject), args...)...)
+	}
+	cmd := exec.Command("docker", append([]string{"compose"}, args...)...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// hasComposeStack reports whether dir holds a compose project dockdev can run
+func hasComposeStack(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, DockerComposeFile)); err == nil {
+		return true
+	}
+	return adoptedState(dir) != nil
+}
+
 func runDockerComposeUp(dir string) error {
 	PrintDivider()
 	fmt.Println(Bold("STARTING DOCKER SERVICES"))
 	fmt.Println(Highlight("Starting services with docker-compose in"), Info(dir))
 	
-	cmd := exec.Command("docker", "compose", "up", "-d")
-	cmd.Dir = dir
+	cmd := composeCommand(dir, "up", "-d")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	err := cmd.Run()
@@ -107,9 +105,8 @@ func runDockerComposeDown(dir string) error {
     }
     
     // Verify docker-compose.yml exists in the directory
-    composeFile := fmt.Sprintf("%s/%s", dir, DockerComposeFile)
-    if _, err := os.Stat(composeFile); os.IsNotExist(err) {
-        return fmt.Errorf("docker-compose file not found: %s", composeFile)
+    if !hasComposeStack(dir) {
+        return fmt.Errorf("docker-compose file not found: %s", filepath.Join(dir, DockerComposeFile))
     }
     
     PrintDivider()
@@ -121,18 +118,24 @@ func runDockerComposeDown(dir string) error {
         return !strings.Contains(line, "Warning: No resource found to remove")
     })
     
-    cmd := exec.Command("docker", "compose", "down")
-    cmd.Dir = dir
+    cmd := composeCommand(dir, "down")
 	cmd.Stdout = stdoutBuf
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
 // restartNginxReverseProxy attempts to reload the Nginx configuration.
-// If reload fails, it will restart the container.
+// The configuration is tested first, a config nginx rejects is never loaded.
+// If reload fails otherwise, it will restart the container.
 func restartNginxReverseProxy() error {
     PrintDivider()
     fmt.Println(Bold("RESTARTING NGINX PROXY"))
+    fmt.Println(Highlight("Testing reverse proxy configuration..."))
+
+    if err := testProxyConfig(); err != nil {
+        return err
+    }
+
     fmt.Println(Highlight("Reloading reverse proxy configuration..."))
     
     // First try to reload Nginx configuration
@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DatabaseEngine is a shared database server that projects get their own database on
+type DatabaseEngine interface {
+	// Name returns the engine identifier, e.g. "mysql"
+	Name() string
+	// Container returns the shared container the engine runs in
+	Container() string
+	// WaitReady blocks until the server accepts connections
+	WaitReady() error
+	// Provision creates the project database and a user that can only access it
+	Provision(db *DatabaseState) error
+	// Drop removes the project database and its user
+	Drop(db *DatabaseState) error
+	// Reset drops and recreates the project database, keeping the user
+	Reset(db *DatabaseState) error
+	// Dump writes an SQL dump of the project database to w
+	Dump(db *DatabaseState, w io.Writer) error
+	// Restore loads an SQL dump from r into the project database
+	Restore(db *DatabaseState, r io.Reader) error
+	// Client returns the exec options for an interactive client connected as the project user
+	Client(db *DatabaseState, args []string) execOptions
+	// AppEnv returns the connection settings written to the app's .env
+	AppEnv(db *DatabaseState) []EnvValue
+	// IdentifierLimit returns the maximum length of database and user names
+	IdentifierLimit() (database int, user int)
+}
+
+// Supported database engines
+const (
+	EngineMySQL    = "mysql"
+	EngineMariaDB  = "mariadb"
+	EnginePostgres = "postgres"
+)
+
+// SupportedEngines lists the engine names in the order they are offered
+var SupportedEngines = []string{EngineMySQL, EngineMariaDB, EnginePostgres}
+
+// databaseEngine returns the engine implementation for a name. An empty name means MySQL,
+// which is what projects created before engines were pluggable use.
+func databaseEngine(name string) (DatabaseEngine, error) {
+	loadConfig()
+
+	switch name {
+	case "", EngineMySQL:
+		return &mysqlEngine{
+			name:      EngineMySQL,
+			container: SharedMySQLName,
+			rootPass:  rootSecret(EnvMySQLRootPassword),
+			client:    "mysql",
+			dump:      "mysqldump",
+		}, nil
+	case EngineMariaDB:
+		return &mysqlEngine{
+			name:      EngineMariaDB,
+			container: SharedMariaDBName,
+			rootPass:  mariadbRootPassword(),
+			client:    "mariadb",
+			dump:      "mariadb-dump",
+		}, nil
+	case EnginePostgres:
+		return &postgresEngine{}, nil
+	}
+	return nil, fmt.Errorf("unknown database engine %q (supported: %s)", name, strings.Join(SupportedEngines, ", "))
+}
+
+// projectEngine returns the engine a project database lives on
+func projectEngine(db *DatabaseState) (DatabaseEngine, error) {
+	return databaseEngine(db.Engine)
+}
+
+// mariadbRootPassword returns the MariaDB root password, which defaults to the MySQL one
+func mariadbRootPassword() string {
+	if value := rootSecret(EnvMariaDBRootPassword); value != "" {
+		return value
+	}
+	return rootSecret(EnvMySQLRootPassword)
+}
+
+// configuredEngines returns the engines enabled with SHARED_DB_ENGINES in the order
+// they are listed, MySQL when the setting is empty. The first one is the default.
+func configuredEngines() ([]string, error) {
+	value := os.Getenv(EnvSharedDBEngines)
+	if strings.TrimSpace(value) == "" {
+		value = EngineMySQL
+	}
+
+	var engines []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, err := databaseEngine(name); err != nil {
+			return nil, fmt.Errorf("%s: %w", EnvSharedDBEngines, err)
+		}
+		seen[name] = true
+		engines = append(engines, name)
+	}
+	return engines, nil
+}
+
+// defaultEngine returns the engine used when a project doesn't choose one
+func defaultEngine() string {
+	engines, err := configuredEngines()
+	if err != nil || len(engines) == 0 {
+		return EngineMySQL
+	}
+	return engines[0]
+}
+
+// sharedEngineIPs maps each engine to the IP setting of its shared container
+var sharedEngineIPs = map[string]string{
+	EngineMySQL:    EnvSharedMySQLIP,
+	EngineMariaDB:  EnvSharedMariaDBIP,
+	EnginePostgres: EnvSharedPostgresIP,
+}
+
+// renderedEngines returns the engines present in an existing shared compose file
+func renderedEngines(composePath string) map[string]bool {
+	engines := map[string]bool{}
+	content, err := os.ReadFile(composePath)
+	if err != nil {
+		return engines
+	}
+	for _, name := range SupportedEngines {
+		engine, _ := databaseEngine(name)
+		if strings.Contains(string(content), "container_name: "+engine.Container()) {
+			engines[name] = true
+		}
+	}
+	return engines
+}
+
+// sharedEngineSet returns the engines shared-services runs: those already in its compose
+// file, the configured ones and extra. missing reports whether the file lacks any of them.
+func sharedEngineSet(composePath string, extra ...string) (engines map[string]bool, missing bool, err error) {
+	configured, err := configuredEngines()
+	if err != nil {
+		return nil, false, err
+	}
+
+	engines = renderedEngines(composePath)
+	_, statErr := os.Stat(composePath)
+	missing = os.IsNotExist(statErr)
+	for _, name := range append(configured, extra...) {
+		if !engines[name] {
+			engines[name] = true
+			missing = true
+		}
+	}
+	return engines, missing, nil
+}
+
+// mapSharedEngineIPs records the addresses of the shared engine containers in .ipmap.env
+func mapSharedEngineIPs(engines map[string]bool) error {
+	for name := range engines {
+		key := sharedEngineIPs[name]
+		ip := os.Getenv(key)
+		if ip == "" {
+			return fmt.Errorf("%s is not set in .env, it is required for the shared %s container", key, name)
+		}
+		_ = InsertIPMappingAtTop(IPMapPath, "shared-"+name, ip)
+	}
+	return nil
+}
+
+// ensureSharedEngines renders shared-services/docker-compose.yml with every configured
+// engine plus the one the new project needs. An existing file is only rendered again
+// when an engine is missing from it. Local edits are merged in when the originally
+// rendered version is known, otherwise they are replaced.
+func ensureSharedEngines(templateName, composePath string, data SharedTemplateData, engine string) error {
+	engines, missing, err := sharedEngineSet(composePath, engine)
+	if err != nil {
+		return err
+	}
+	if !missing {
+		return nil
+	}
+	data.Engines = engines
+
+	if err := mapSharedEngineIPs(data.Engines); err != nil {
+		return err
+	}
+
+	content, err := renderTemplateBytes(templateName, data)
+	if err != nil {
+		return err
+	}
+	root := filepath.Dir(composePath)
+	plan, err := planUpgrade(root, []templateOutput{{Path: filepath.Base(composePath), Content: content}})
+	if err != nil {
+		return err
+	}
+	switch action := plan[0].Action; {
+	case action == upgradeCreate || action == upgradeDeleted:
+		fmt.Println("Generating " + composePath)
+		plan[0].Action = upgradeCreate
+	case action == upgradeConflict:
+		return fmt.Errorf("adding database engines conflicts with local edits of %s, merge them with `dockdev upgrade --shared`", composePath)
+	case action == upgradeNoBase:
+		fmt.Println(Warning("Adding database engines to"), Info(composePath), Warning("- manual changes to it are replaced"))
+		plan[0].Action = upgradeReplace
+	default:
+		fmt.Println(Info("Adding database engines to"), Info(composePath))
+	}
+	fmt.Println(Info("Shared database engines:"), Bold(strings.Join(engineNames(data.Engines), ", ")))
+
+	// Credentials go to secret files referenced by the compose file, never into it
+	if err := writeSharedSecrets(data.Engines); err != nil {
+		return err
+	}
+
+	if err := applyUpgrade(root, plan, false); err != nil {
+		return err
+	}
+	return saveSharedTemplateVars(data.Vars)
+}
+
+// engineNames returns the sorted names of an engine set
+func engineNames(engines map[string]bool) []string {
+	var names []string
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// backupProjectDatabase dumps the project database to backups/<domain>/<timestamp>.sql.gz
+func backupProjectDatabase(domain string, db *DatabaseState) (string, error) {
+	engine, err := projectEngine(db)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(BackupsDir, domain)
+	if err := CreateDirIfNotExist(dir); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+".sql.gz")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	if err := engine.Dump(db, gz); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeAppDatabaseEnv writes the project database settings into the app's .env
+func writeAppDatabaseEnv(appDir string, db *DatabaseState) error {
+	engine, err := projectEngine(db)
+	if err != nil {
+		return err
+	}
+	return upsertEnvFile(filepath.Join(appDir, ".env"), engine.AppEnv(db))
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvValue is a single KEY=value pair in a dotenv file
+type EnvValue struct {
+	Key   string
+	Value string
+}
+
+// upsertEnvFile sets keys in a dotenv file, replacing existing assignments in place and
+// appending new ones. Comments and unrelated lines are kept. The file is created if needed.
+func upsertEnvFile(path string, values []EnvValue) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	pending := make(map[string]string, len(values))
+	for _, v := range values {
+		pending[v.Key] = v.Value
+	}
+
+	var lines []string
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	}
+	for i, line := range lines {
+		key := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		if value, ok := pending[key]; ok && strings.Contains(line, "=") {
+			lines[i] = fmt.Sprintf("%s=%s", key, quoteEnvValue(value))
+			delete(pending, key)
+		}
+	}
+
+	for _, v := range values {
+		if _, ok := pending[v.Key]; ok {
+			lines = append(lines, fmt.Sprintf("%s=%s", v.Key, quoteEnvValue(v.Value)))
+		}
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// quoteEnvValue quotes a value when a dotenv parser would otherwise misread it
+func quoteEnvValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t#\"'$\\") {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(value) + `"`
+	}
+	return value
+}
@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+)
+
+// ExitCodeError carries the exit code of a command run inside a container so the
+// caller can exit with the same code instead of printing a generic error
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.Code)
+}
+
+// execOptions describes a command to run inside a container
+type execOptions struct {
+	Container string
+	User      string
+	WorkDir   string
+	Env       []string
+	SecretEnv map[string]string // passed by name only, values never appear on the command line
+	Command   []string
+}
+
+// runInContainer runs a command with docker exec, attaching the current stdin/stdout/stderr.
+// A TTY is allocated when dockdev itself runs in one.
+func runInContainer(opts execOptions) error {
+	args := []string{"exec", "-i"}
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		args = append(args, "-t")
+	}
+	if opts.User != "" {
+		args = append(args, "-u", opts.User)
+	}
+	if opts.WorkDir != "" {
+		args = append(args, "-w", opts.WorkDir)
+	}
+	for _, env := range opts.Env {
+		args = append(args, "-e", env)
+	}
+	args, env := appendSecretEnv(args, opts.SecretEnv)
+	args = append(args, opts.Container)
+	args = append(args, opts.Command...)
+
+	cmd := exec.Command("docker", args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitCodeError{Code: exitErr.ExitCode()}
+	}
+	return err
+}
+
+// appendSecretEnv adds "-e NAME" for each secret and returns the environment for the docker
+// process. Without a value docker copies the variable from its own environment, so the
+// secret never appears on a command line.
+func appendSecretEnv(args []string, secrets map[string]string) ([]string, []string) {
+	env := os.Environ()
+	for name, value := range secrets {
+		args = append(args, "-e", name)
+		env = append(env, name+"="+value)
+	}
+	return args, env
+}
+
+// dockerExec builds a docker exec command for dockdev's own use, with stdin attached
+// but no TTY. Secrets are passed like in runInContainer.
+func dockerExec(container string, secrets map[string]string, command ...string) *exec.Cmd {
+	args, env := appendSecretEnv([]string{"exec", "-i"}, secrets)
+	args = append(args, container)
+	args = append(args, command...)
+
+	cmd := exec.Command("docker", args...)
+	cmd.Env = env
+	return cmd
+}
+
+// execInService runs a command in one of the project's service containers. App
+// services run as the user mapped at project creation, so created files stay editable.
+func execInService(domain, service string, asRoot bool, command ...string) error {
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+
+	container, err := state.Container(service)
+	if err != nil {
+		return err
+	}
+
+	opts := execOptions{Container: container, Command: command}
+	if isAppService(service) {
+		opts.WorkDir = AppDirInContainer
+		if !asRoot {
+			opts.User = state.User
+		}
+	}
+	return runInContainer(opts)
+}
+
+// isAppService reports whether the service works on the mounted app directory
+func isAppService(service string) bool {
+	for _, s := range AppServices {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// ShellCommand implements `dockdev shell <domain> [service] [--root]`
+func ShellCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 {
+		return fmt.Errorf("usage: shell <domain> [service] [--root]")
+	}
+
+	domain := parsed.Positional[0]
+	service := DefaultShellService
+	if len(parsed.Positional) > 1 {
+		service = parsed.Positional[1]
+	}
+
+	// Not every image ships bash, fall back to sh
+	shell := []string{"sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"}
+	return execInService(domain, service, parsed.Has("root"), shell...)
+}
+
+// passthroughCommand returns a handler that runs a tool inside a project service with
+// all remaining arguments passed through unchanged
+func passthroughCommand(name, service string, tool ...string) func(args []string) error {
+	return func(args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("usage: %s <domain> [arguments...]", name)
+		}
+		command := append(append([]string{}, tool...), args[1:]...)
+		return execInService(args[0], service, false, command...)
+	}
+}
+
+// Tool passthrough commands
+var (
+	ComposerCommand = passthroughCommand("composer", "php", "composer")
+	ArtisanCommand  = passthroughCommand("artisan", "php", "php", "artisan")
+	NpmCommand      = passthroughCommand("npm", "node", "npm")
+	YarnCommand     = passthroughCommand("yarn", "node", "yarn")
+)
+
+// MySQLCommand implements `dockdev mysql <domain> [arguments...]`, kept as an alias of
+// `dockdev db shell` from before other engines were supported
+func MySQLCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: mysql <domain> [arguments...]")
+	}
+	return openDatabaseClient(args[0], args[1:])
+}
+
+// openDatabaseClient opens the engine's client in the shared database container, connected
+// to the project database as the project user. Passwords never appear on the host command line.
+func openDatabaseClient(domain string, args []string) error {
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+
+	if state.Database == nil {
+		// Projects without their own database use the shared user from the container environment
+		// The password is in the environment on older setups, a compose secret on newer ones
+		command := []string{"sh", "-c",
+			`MYSQL_PWD="${MYSQL_PASSWORD:-$(cat /run/secrets/mysql_password 2>/dev/null)}" exec mysql -u"$MYSQL_USER" "$@"`, "mysql"}
+		command = append(command, args...)
+		return runInContainer(execOptions{Container: SharedMySQLName, Command: command})
+	}
+
+	engine, err := projectEngine(state.Database)
+	if err != nil {
+		return err
+	}
+	return runInContainer(engine.Client(state.Database, args))
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Exposure makes a service port reachable on its own subdomain of the project,
+// e.g. vite.app.test -> node:5173
+type Exposure struct {
+	Subdomain string `json:"subdomain"`
+	Service   string `json:"service"`
+	Port      int    `json:"port"`
+}
+
+// Host returns the full host name of the exposure
+func (e Exposure) Host(domain string) string {
+	return e.Subdomain + "." + domain
+}
+
+// SiteExposure is an exposure as rendered into the reverse proxy site conf
+type SiteExposure struct {
+	Host     string
+	Upstream string // proxy_pass URL
+}
+
+var (
+	subdomainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	// exposeDirective declares an exposure in the compose template:
+	//   # dockdev:expose vite node:5173
+	exposeDirective = regexp.MustCompile(`(?m)^\s*#\s*dockdev:expose\s+(\S+)\s+([a-z0-9_-]+):(\d+)\s*$`)
+)
+
+// templateExposures returns the exposures declared in a compose template
+func templateExposures(templateName string) ([]Exposure, error) {
+	content, err := readTemplate(templateName)
+	if err != nil {
+		return nil, err
+	}
+
+	var exposures []Exposure
+	for _, m := range exposeDirective.FindAllStringSubmatch(string(content), -1) {
+		port, _ := strconv.Atoi(m[3])
+		exposures = append(exposures, Exposure{Subdomain: m[1], Service: m[2], Port: port})
+	}
+	return exposures, nil
+}
+
+// validate checks an exposure against the project before it is rendered
+func (e Exposure) validate(state *ProjectState) error {
+	if !subdomainPattern.MatchString(e.Subdomain) {
+		return fmt.Errorf("invalid subdomain %q: use lowercase letters, digits and dashes", e.Subdomain)
+	}
+	if _, err := state.ServiceIP(e.Service); err != nil {
+		return err
+	}
+	if slices.Contains(state.DisabledServices, e.Service) {
+		return fmt.Errorf("service %s is not enabled in this project", e.Service)
+	}
+	if e.Port < 1 || e.Port > 65535 {
+		return fmt.Errorf("invalid port %d", e.Port)
+	}
+	return nil
+}
+
+// siteExposures resolves the exposures of a project to upstream addresses
+func siteExposures(state *ProjectState) ([]SiteExposure, error) {
+	var site []SiteExposure
+	for _, exposure := range state.Exposures {
+		ip, err := state.ServiceIP(exposure.Service)
+		if err != nil {
+			return nil, err
+		}
+		site = append(site, SiteExposure{
+			Host:     exposure.Host(state.Domain),
+			Upstream: fmt.Sprintf("http://%s:%d", ip, exposure.Port),
+		})
+	}
+	return site, nil
+}
+
+// exposedHosts returns the host names of all exposures of a project
+func exposedHosts(state *ProjectState) []string {
+	var hosts []string
+	for _, exposure := range state.Exposures {
+		hosts = append(hosts, exposure.Host(state.Domain))
+	}
+	return hosts
+}
+
+// findExposure returns the index of the exposure with the subdomain, or -1
+func findExposure(exposures []Exposure, subdomain string) int {
+	for i, exposure := range exposures {
+		if exposure.Subdomain == subdomain {
+			return i
+		}
+	}
+	return -1
+}
+
+// issueProjectCert makes sure the project certificate covers the domain and every
+// exposed host, and copies it into the project's nginx ssl directory
+func issueProjectCert(state *ProjectState) error {
+	if !state.UseSSL {
+		return nil
+	}
+	crtPath, keyPath, err := generateDomainCert(state.Domain, CertsDir, exposedHosts(state)...)
+	if err != nil {
+		return fmt.Errorf("Domain SSL generation failed: %w", err)
+	}
+	return CopyCertificates(crtPath, keyPath, filepath.Join(ProjectDir(state.Domain), "conf", "nginx", "ssl"))
+}
+
+// ExposeCommand implements `dockdev expose <domain> [service:port] [--subdomain x] [--rm x]`
+func ExposeCommand(args []string) error {
+	usage := fmt.Errorf("usage: expose <domain> <service>:<port> [--subdomain name] | expose <domain> --rm <subdomain> | expose <domain>")
+	parsed, err := parseArgs(args, "subdomain", "rm")
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 {
+		return usage
+	}
+
+	domain := parsed.Positional[0]
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Has("rm") {
+		return unexposeService(state, parsed.Get("rm", ""))
+	}
+	if len(parsed.Positional) < 2 {
+		return listExposures(state)
+	}
+
+	service, portValue, ok := strings.Cut(parsed.Positional[1], ":")
+	if !ok {
+		return usage
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portValue)
+	}
+	exposure := Exposure{Subdomain: parsed.Get("subdomain", service), Service: service, Port: port}
+	if err := exposure.validate(state); err != nil {
+		return err
+	}
+
+	previous := state.Exposures
+	if i := findExposure(state.Exposures, exposure.Subdomain); i >= 0 {
+		state.Exposures = append(append([]Exposure{}, state.Exposures[:i]...), state.Exposures[i+1:]...)
+		fmt.Println(Info("Replacing the existing exposure"), Bold(exposure.Host(domain)))
+	}
+	state.Exposures = append(state.Exposures, exposure)
+
+	if err := issueProjectCert(state); err != nil {
+		state.Exposures = previous
+		return err
+	}
+	if err := applyProxySite(state); err != nil {
+		state.Exposures = previous
+		return err
+	}
+	if err := SaveProjectState(state); err != nil {
+		return err
+	}
+	if err := CurrentPlatform().AddHostsEntry(exposure.Host(domain)); err != nil {
+		fmt.Println(Warning("Warning: failed to update hosts file:"), Error(err.Error()))
+	}
+
+	scheme := "http://"
+	if state.UseSSL {
+		scheme = "https://"
+	}
+	fmt.Println(Success("Exposed"), Info(fmt.Sprintf("%s:%d", exposure.Service, exposure.Port)), Success("at"),
+		Bold(Highlight(scheme+exposure.Host(domain))))
+	return nil
+}
+
+// unexposeService removes an exposure, its proxy server block and hosts entry. The
+// certificate keeps the name until it is issued again, which does no harm.
+func unexposeService(state *ProjectState, subdomain string) error {
+	i := findExposure(state.Exposures, subdomain)
+	if i < 0 {
+		return fmt.Errorf("%s.%s is not exposed", subdomain, state.Domain)
+	}
+	host := state.Exposures[i].Host(state.Domain)
+
+	previous := state.Exposures
+	state.Exposures = append(append([]Exposure{}, state.Exposures[:i]...), state.Exposures[i+1:]...)
+	if err := applyProxySite(state); err != nil {
+		state.Exposures = previous
+		return err
+	}
+	if err := SaveProjectState(state); err != nil {
+		return err
+	}
+	if err := CurrentPlatform().RemoveHostsEntry(host); err != nil {
+		fmt.Println(Warning("Warning: failed to update hosts file:"), Error(err.Error()))
+	}
+	fmt.Println(Success("Removed exposure:"), Bold(host))
+	return nil
+}
+
+// listExposures prints the exposed subdomains of a project
+func listExposures(state *ProjectState) error {
+	if len(state.Exposures) == 0 {
+		fmt.Println(Info("No services exposed on subdomains of " + state.Domain + "."))
+		return nil
+	}
+	fmt.Println(Bold("Exposed services of " + state.Domain + ":"))
+	for _, exposure := range state.Exposures {
+		fmt.Printf("  %-32s -> %s\n", exposure.Host(state.Domain), fmt.Sprintf("%s:%d", exposure.Service, exposure.Port))
+	}
+	return nil
+}
@@ -3,53 +3,124 @@ package internal
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
-	"github.com/joho/godotenv"
+	"time"
 )
 
 type TemplateData struct {
-	Domain       string
-	Prefix       string
-	NetworkName  string
-	IPsByService map[string]string
-	UseSSL       bool
+	Domain           string
+	Prefix           string
+	ProjectName      string
+	NetworkName      string
+	IPsByService     map[string]string
+	UseSSL           bool
+	Stack            StackState        // PHP and Node.js versions the images are built with
+	Routes           []SiteRoute       // reverse proxy locations of the site conf
+	Exposures        []SiteExposure    // extra server blocks for services exposed on subdomains
+	Vars             map[string]string // template variables, see templatevars.go
+	AppMount         string            // host directory mounted as the app instead of ./app, see AppDir
+	DisabledServices []string          // services left out of docker-compose.yml, see Enabled
 }
 
 type SharedTemplateData struct {
-	NetworkName        string
-	ReverseProxyIP     string
-	SharedMySQLIP      string
-	MySQLRootPassword  string
-	MySQLUser          string
-	MySQLPassword      string
+	NetworkName      string
+	ReverseProxyIP   string
+	SharedMySQLIP    string
+	MySQLUser        string
+	SharedMariaDBIP  string
+	SharedPostgresIP string
+	Engines          map[string]bool   // database engines to run, keyed by engine name
+	Vars             map[string]string // template variables, see templatevars.go
+}
+
+// ProjectOptions are the choices made when creating a project
+type ProjectOptions struct {
+	UseSSL           bool
+	Engine           string            // database engine, empty for the first one in SHARED_DB_ENGINES
+	Stack            StackState        // empty versions mean the defaults
+	Vars             map[string]string // template variables set with --set
+	Source           *AppSource        // existing code to start from, nil for templates/app
+	DisabledServices []string          // services to leave out, detected from the Source code when nil
+}
+
+// DefaultProjectOptions returns the options used when nothing is chosen
+func DefaultProjectOptions() ProjectOptions {
+	return ProjectOptions{UseSSL: SSLEnabled, Stack: defaultStack()}
 }
 
 // GenerateProject creates a new project with the given domain name
-// The useSSL parameter controls whether SSL is enabled for the project
 // Currently, SSL is required for the application to work correctly
-func GenerateProject(domain string, useSSL ...bool) error {
+func GenerateProject(domain string, opts ProjectOptions) error {
+	if err := generateProject(domain, opts); err != nil {
+		return err
+	}
+	announceProject(domain)
+	return nil
+}
+
+// generateProject creates and starts the project and waits until it is ready
+func generateProject(domain string, opts ProjectOptions) error {
+	if err := validateDomain(domain); err != nil {
+		return err
+	}
+
 	// Ensure Docker is running before proceeding
 	if err := EnsureDockerRunning(); err != nil {
 		return fmt.Errorf("Docker check failed: %w", err)
 	}
 
-	enableSSL := SSLEnabled
+	enableSSL := opts.UseSSL
+
+	if links, err := loadLinks(); err == nil {
+		if _, ok := links[domain]; ok {
+			return fmt.Errorf("%s is linked to %s, run `dockdev unlink %s` first", domain, links[domain].Upstream, domain)
+		}
+	}
+
+	// Missing or malformed settings would otherwise surface as a broken compose file
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	engineName := opts.Engine
+	if engineName == "" {
+		engineName = defaultEngine()
+	}
+	engine, err := databaseEngine(engineName)
+	if err != nil {
+		return err
+	}
 
-	// If useSSL parameter is provided, use it
-	if len(useSSL) > 0 {
-		enableSSL = useSSL[0]
+	if opts.Source != nil {
+		if err := opts.Source.resolve(); err != nil {
+			return err
+		}
 	}
 
-	if err := godotenv.Load(".env"); err != nil {
-		return fmt.Errorf("error loading .env file: %w", err)
+	stack := opts.Stack.withDefaults()
+	if err := stack.validate(); err != nil {
+		return err
+	}
+
+	// Render every template with sample data first, so a template error stops here and
+	// not after half of the project is generated
+	vars, err := templateVars(opts.Vars)
+	if err != nil {
+		return err
+	}
+	if problems, _, err := lintTemplates(vars); err != nil {
+		return err
+	} else if len(problems) > 0 {
+		return fmt.Errorf("template %s: %w (check all with `dockdev templates lint`)", problems[0].Name, problems[0].Err)
 	}
 
 	network := os.Getenv(EnvNetworkName)
 	baseIP := os.Getenv(EnvProjectStartIP)
 	mysqlIP := os.Getenv(EnvSharedMySQLIP)
 	projectDir := filepath.Join(ProjectDirPrefix, domain)
-	prefix := strings.Split(domain, ".")[0]
+	prefix := projectPrefix(domain)
+	projectName := composeProjectName(prefix)
 
 	if mysqlIP != "" {
 		_ = InsertIPMappingAtTop(IPMapPath, "shared-mysql", mysqlIP)
@@ -58,45 +129,92 @@ func GenerateProject(domain string, useSSL ...bool) error {
 	if _, err := os.Stat(projectDir); !os.IsNotExist(err) {
 		return fmt.Errorf("Project already exists: %s", projectDir)
 	}
-	if err := CreateDirIfNotExist(projectDir); err != nil {
-		return fmt.Errorf("failed to create project directory: %w", err)
-	}
 
-	usedIPs, err := LoadUsedIPs(IPMapPath)
+	// Make sure the containers of this project can't clash with an existing one
+	containerNames, err := plannedContainerNames(
+		DockerComposeFile+".tmpl",
+		TemplateData{Domain: domain, Prefix: prefix, ProjectName: projectName, NetworkName: network, Vars: vars},
+	)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read %s template: %w", DockerComposeFile, err)
 	}
-
-	ipKeys, err := ExtractIPKeysFromTemplate(filepath.Join(TemplateDir, DockerComposeFile+".tmpl"))
-	if err != nil {
+	if err := checkNameConflicts(TemplateData{Domain: domain, Prefix: prefix, ProjectName: projectName}, containerNames); err != nil {
 		return err
 	}
 
-	ipMap := map[string]string{}
+	if err := ensureWorkspaceMarker(); err != nil {
+		return fmt.Errorf("failed to mark the workspace root: %w", err)
+	}
+	if err := CreateDirIfNotExist(projectDir); err != nil {
+		return fmt.Errorf("failed to create project directory: %w", err)
+	}
 
-	for _, key := range ipKeys {
-		ip, err := FindNextFreeIP(baseIP, usedIPs)
-		if err != nil {
+	// Existing code goes to app/ first, the services it needs decide what gets rendered
+	appDstDir := filepath.Join(projectDir, "app")
+	var appMount string
+	var disabledServices []string
+	if opts.Source != nil {
+		if err := opts.Source.populate(appDstDir); err != nil {
+			os.RemoveAll(projectDir)
 			return err
 		}
-		usedIPs[ip] = true
-		ipMap[key] = ip
-
-		entry := domain
-		if key != "main" {
-			entry += "_" + key
+		if opts.Source.Mounted {
+			appDstDir = opts.Source.Path
+			appMount = opts.Source.Path
 		}
-		if err := AppendIPMapping(IPMapPath, entry, ip); err != nil {
-			return err
+		if opts.DisabledServices == nil {
+			disabledServices = detectDisabledServices(appDstDir)
 		}
 	}
+	if opts.DisabledServices != nil {
+		disabledServices = opts.DisabledServices
+	}
+
+	ipKeys, err := ExtractIPKeysFromTemplate(DockerComposeFile+".tmpl")
+	if err != nil {
+		return err
+	}
+
+	ipMap, err := nextServiceIPs(baseIP, ipKeys, map[string]string{})
+	if err != nil {
+		return err
+	}
+	if err := recordServiceIPs(domain, ipKeys, ipMap); err != nil {
+		return err
+	}
 
 	data := TemplateData{
 		Domain: domain,
 		Prefix: prefix,
+		ProjectName: projectName,
 		NetworkName: network,
 		IPsByService: ipMap,
 		UseSSL: enableSSL,
+		Stack: stack,
+		Vars: vars,
+		AppMount: appMount,
+		DisabledServices: disabledServices,
+	}
+
+	// Services declared with "# dockdev:expose" in the template get their own subdomain
+	exposures, err := templateExposures(DockerComposeFile+".tmpl")
+	if err != nil {
+		return err
+	}
+	exposures = filterExposures(exposures, disabledServices)
+	site := &ProjectState{Domain: domain, IPsByService: ipMap, Exposures: exposures}
+	for _, exposure := range exposures {
+		if err := exposure.validate(site); err != nil {
+			return fmt.Errorf("invalid dockdev:expose in %s: %w", DockerComposeFile+".tmpl", err)
+		}
+	}
+
+	// New projects start with the default route, more are added with `dockdev route add`
+	if data.Routes, err = siteRoutes(site); err != nil {
+		return err
+	}
+	if data.Exposures, err = siteExposures(site); err != nil {
+		return err
 	}
 
 	if enableSSL {
@@ -104,7 +222,7 @@ func GenerateProject(domain string, useSSL ...bool) error {
 			return fmt.Errorf("SSL rootCA failed: %w", err)
 		}
 
-		crtPath, keyPath, err := generateDomainCert(domain, CertsDir)
+		crtPath, keyPath, err := generateDomainCert(domain, CertsDir, exposedHosts(site)...)
 		if err != nil {
 			return fmt.Errorf("Domain SSL generation failed: %w", err)
 		}
@@ -118,15 +236,25 @@ func GenerateProject(domain string, useSSL ...bool) error {
 
 	// Render docker-compose.yml from template
 	if err := RenderTemplate(
-		filepath.Join(TemplateDir, DockerComposeFile+".tmpl"),
+		DockerComposeFile+".tmpl",
 		filepath.Join(projectDir, DockerComposeFile),
 		data,
 	); err != nil {
 		return err
 	}
 
+	// The build args in docker-compose.yml are read from the project's .env, so `dockdev set` can change them
+	if err := writeStackEnv(projectDir, stack); err != nil {
+		return err
+	}
+
 	// Copy all required directories from template to project
-	if err := CopyTemplatedDirectories(TemplateDir, projectDir, ProjectFolders); err != nil {
+	if err := CopyTemplatedDirectories(projectDir, ProjectFolders); err != nil {
+		return err
+	}
+
+	// `dockdev php` writes its mode files here, it must exist before compose mounts it
+	if err := CreateDirIfNotExist(filepath.Join(projectDir, "conf", "php", PHPModesDir)); err != nil {
 		return err
 	}
 
@@ -137,25 +265,26 @@ func GenerateProject(domain string, useSSL ...bool) error {
 	}
 
 	if err := RenderTemplate(
-		filepath.Join(TemplateDir, "nginx.conf.tmpl"),
+		"nginx.conf.tmpl",
 		filepath.Join(confDir, "default.conf"),
 		data,
 	); err != nil {
 		return err
 	}
 
-	// Create and render app/index.html
-	appDstDir := filepath.Join(projectDir, "app")
-	if err := CreateDirIfNotExist(appDstDir); err != nil {
-		return fmt.Errorf("failed to create app directory: %w", err)
-	}
+	// Without existing code the project starts from app/index.html
+	if opts.Source == nil {
+		if err := CreateDirIfNotExist(appDstDir); err != nil {
+			return fmt.Errorf("failed to create app directory: %w", err)
+		}
 
-	if err := RenderTemplate(
-		filepath.Join(TemplateDir, "app", "index.html"),
-		filepath.Join(appDstDir, "index.html"),
-		data,
-	); err != nil {
-		return err
+		if err := RenderTemplate(
+			"app/index.html",
+			filepath.Join(appDstDir, "index.html"),
+			data,
+		); err != nil {
+			return err
+		}
 	}
 
 	// Create and configure shared services
@@ -164,53 +293,58 @@ func GenerateProject(domain string, useSSL ...bool) error {
 		return fmt.Errorf("failed to create sites directory: %w", err)
 	}
 
-	// Generate shared-services/docker-compose.yml if it doesn't exist
-	sharedComposeTemplate := filepath.Join(TemplateDir, SharedServicesDir, DockerComposeFile+".tmpl")
+	// Generate shared-services/docker-compose.yml if it doesn't exist or lacks the project's engine
+	sharedComposeTemplate := path.Join(SharedServicesDir, DockerComposeFile+".tmpl")
 	sharedComposePath := filepath.Join(SharedServicesDir, DockerComposeFile)
-	if _, err := os.Stat(sharedComposePath); os.IsNotExist(err) {
-		sharedTemplate := SharedTemplateData{
-			NetworkName:        network,
-			ReverseProxyIP:     os.Getenv(EnvReverseProxyIP),
-			SharedMySQLIP:      os.Getenv(EnvSharedMySQLIP),
-			MySQLRootPassword:  os.Getenv(EnvMySQLRootPassword),
-			MySQLUser:          os.Getenv(EnvMySQLUser),
-			MySQLPassword:      os.Getenv(EnvMySQLPassword),
-		}
-
-		if err := RenderTemplate(sharedComposeTemplate, sharedComposePath, sharedTemplate); err != nil {
-			return fmt.Errorf("Failed to render %s: %w", filepath.Join(SharedServicesDir, DockerComposeFile), err)
-		}
-
-		fmt.Println("Generated " + filepath.Join(SharedServicesDir, DockerComposeFile))
+	sharedTemplate, err := sharedTemplateData()
+	if err != nil {
+		return err
+	}
+	if err := ensureSharedEngines(sharedComposeTemplate, sharedComposePath, sharedTemplate, engine.Name()); err != nil {
+		return fmt.Errorf("Failed to render %s: %w", sharedComposePath, err)
 	}
 
 	// Render shared-services/nginx.conf
-	nginxConfTemplate := filepath.Join(TemplateDir, SharedServicesDir, NginxConfFileName+".tmpl")
+	nginxConfTemplate := path.Join(SharedServicesDir, NginxConfFileName+".tmpl")
 	nginxConfDest := filepath.Join(SharedServicesDir, NginxConfFileName)
+	siteConf := filepath.Join(sitesDir, domain+".conf")
+
+	// Keep the current proxy files, so they can be restored if nginx rejects the new ones
+	proxyChange := newProxyConfigChange()
+	if err := proxyChange.track(nginxConfDest); err != nil {
+		return err
+	}
+	if err := proxyChange.track(siteConf); err != nil {
+		return err
+	}
+
 	if err := RenderTemplate(nginxConfTemplate, nginxConfDest, data); err != nil {
 		return fmt.Errorf("Failed to render nginx.conf: %w", err)
 	}
 	fmt.Println("Generated reverse proxy nginx.conf")
 
 	// Copy shared-services/image if it exists
-	sharedImageSrc := filepath.Join(TemplateDir, SharedServicesDir, "image")
+	sharedImageSrc := path.Join(SharedServicesDir, "image")
 	sharedImageDst := filepath.Join(SharedServicesDir, "image")
-	if _, err := os.Stat(sharedImageSrc); err == nil {
-		if err := CopyDir(sharedImageSrc, sharedImageDst); err != nil {
+	if templateExists(sharedImageSrc) {
+		if err := copyTemplateDir(sharedImageSrc, sharedImageDst); err != nil {
 			return fmt.Errorf("Failed to copy shared-services image: %w", err)
 		}
 	}
 
-    // Create site configuration
-    siteConf := filepath.Join(sitesDir, domain+".conf")
+	// Keep the files as rendered, so `dockdev upgrade` can merge later template changes with local edits
+	if err := recordTemplateBases(projectDir, data, sharedComposePath); err != nil {
+		return err
+	}
 
+    // Create site configuration
     if _, err := os.Stat(siteConf); os.IsNotExist(err) {
         tmpl := "site.conf.tmpl"
         if enableSSL {
             tmpl = "site-ssl.conf.tmpl"
         }
 
-        if err := RenderTemplate(filepath.Join(TemplateDir, tmpl), siteConf, data); err != nil {
+        if err := RenderTemplate(tmpl, siteConf, data); err != nil {
             return err
         }
 
@@ -218,22 +352,35 @@ func GenerateProject(domain string, useSSL ...bool) error {
             map[bool]string{true: "SSL", false: "no-SSL"}[enableSSL], siteConf)
     }
 
+	// A broken proxy config would take down every project, test it before anything is started
+	fmt.Println("Testing reverse proxy configuration...")
+	if err := proxyChange.validate(); err != nil {
+		return err
+	}
+
 	fmt.Println("Starting shared-services...")
 	if err := runDockerComposeUp(SharedServicesDir); err != nil {
 		return err
 	}
 
-	root := os.Getenv(EnvMySQLRootPassword)
-	user := os.Getenv(EnvMySQLUser)
-
-	fmt.Println("Waiting for MySQL to become ready...")
-	if err := waitForMySQL(SharedMySQLName, root); err != nil {
+	fmt.Printf("Waiting for %s to become ready...\n", engine.Name())
+	if err := engine.WaitReady(); err != nil {
 		return err
 	}
 
-	fmt.Println("Granting privileges to user...")
-	if err := grantAllPrivileges(SharedMySQLName, root, user); err != nil {
-		return fmt.Errorf("Failed to grant privileges: %w", err)
+	// Every project gets its own database and a user that can only access that database
+	database, err := newProjectDatabase(engine, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to generate database password: %w", err)
+	}
+
+	fmt.Printf("Creating %s database %s and user %s...\n", engine.Name(), database.Name, database.User)
+	if err := engine.Provision(database); err != nil {
+		return fmt.Errorf("Failed to create project database: %w", err)
+	}
+
+	if err := writeAppDatabaseEnv(appDstDir, database); err != nil {
+		return fmt.Errorf("failed to write database settings to %s: %w", filepath.Join(appDstDir, ".env"), err)
 	}
 
 	fmt.Println("Starting project containers...")
@@ -241,15 +388,49 @@ func GenerateProject(domain string, useSSL ...bool) error {
 		return err
 	}
 
+	// Values chosen with --set or generated by randomPassword stay with the project
+	pinned, err := pinnedVars(vars)
+	if err != nil {
+		return err
+	}
+
+	state := &ProjectState{
+		Domain:           domain,
+		Prefix:           prefix,
+		ComposeProject:   projectName,
+		UseSSL:           enableSSL,
+		IPsByService:     ipMap,
+		User:             currentUserMapping(),
+		Database:         database,
+		Exposures:        exposures,
+		Stack:            &stack,
+		Vars:             pinned,
+		Source:           opts.Source,
+		DisabledServices: disabledServices,
+		CreatedAt:        time.Now(),
+	}
+	state.refreshContainers()
+	if err := SaveProjectState(state); err != nil {
+		return fmt.Errorf("failed to save project state: %w", err)
+	}
+
 	// Reload or restart the Nginx reverse proxy
 	if err := restartNginxReverseProxy(); err != nil {
 		return err
 	}
 
-	if err := updateWindowsHosts(domain, WindowsHostsPath); err != nil {
-		return err
+	for _, host := range append([]string{domain}, exposedHosts(state)...) {
+		if err := CurrentPlatform().AddHostsEntry(host); err != nil {
+			return err
+		}
 	}
 
+	// Don't report success until every service is healthy and the site answers through the proxy
+	return waitForProjectReady(domain, projectDir)
+}
+
+// announceProject prints where a new project is reachable and offers to open it
+func announceProject(domain string) {
 	// Display project information
 	PrintSectionDivider("PROJECT CREATED SUCCESSFULLY")
 	fmt.Println(Success("Your new development environment is ready!"))
@@ -268,6 +449,29 @@ func GenerateProject(domain string, useSSL ...bool) error {
 			fmt.Println(Info("You can open this URL in your browser when ready:"), Highlight(projectURL))
 		}
 	}
+}
+
+// recordTemplateBases records the freshly generated project and shared-services files
+// as the base of the next upgrade
+func recordTemplateBases(projectDir string, data TemplateData, sharedComposePath string) error {
+	outputs, err := projectTemplateOutputs(data)
+	if err != nil {
+		return err
+	}
+	if err := recordBase(projectDir, outputs); err != nil {
+		return fmt.Errorf("failed to record template versions: %w", err)
+	}
 
+	shared, err := sharedTemplateData()
+	if err != nil {
+		return err
+	}
+	shared.Engines = renderedEngines(sharedComposePath)
+	if outputs, err = sharedTemplateOutputs(shared); err != nil {
+		return err
+	}
+	if err := recordBase(SharedServicesDir, outputs); err != nil {
+		return fmt.Errorf("failed to record template versions: %w", err)
+	}
 	return nil
 }
@@ -1,39 +1,60 @@
 package internal
 
 import (
-    "bufio"
-    "os"
+    "bytes"
     "fmt"
+    "os"
+    "os/exec"
     "strings"
 )
 
-func updateWindowsHosts(domain, path string) error {
+// hostsLineHasDomain checks whether a hosts file line maps the exact domain
+func hostsLineHasDomain(line, domain string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	for _, host := range fields[1:] {
+		if strings.HasPrefix(host, "#") {
+			break
+		}
+		if strings.EqualFold(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func addHostsEntry(domain, path string) error {
 	hostsEntry := fmt.Sprintf("127.0.0.1 %s", domain)
 
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		if strings.Contains(scanner.Text(), domain) {
+	for _, line := range strings.Split(string(content), "\n") {
+		if hostsLineHasDomain(line, domain) {
 			fmt.Println("Hosts entry already exists.")
 			return nil
 		}
 	}
 
-	if _, err := file.WriteString("\n" + hostsEntry + "\n"); err != nil {
+	updated := string(content)
+	if updated != "" && !strings.HasSuffix(updated, "\n") {
+		updated += "\n"
+	}
+	updated += hostsEntry + "\n"
+
+	if err := writeHostsFile(path, []byte(updated)); err != nil {
 		return err
 	}
 
-	fmt.Println("Domain added to Windows hosts file.")
+	fmt.Println("Domain added to hosts file:", path)
 	return nil
 }
 
-func removeFromWindowsHosts(domain, path string) error {
+func removeHostsEntry(domain, path string) error {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return err
@@ -41,16 +62,39 @@ func removeFromWindowsHosts(domain, path string) error {
 
 	var lines []string
 	for _, line := range strings.Split(string(content), "\n") {
-		if !strings.Contains(line, domain) {
+		if !hostsLineHasDomain(line, domain) {
 			lines = append(lines, line)
 		}
 	}
-	
-	err = os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+
+	err = writeHostsFile(path, []byte(strings.Join(lines, "\n")))
 	if err != nil {
 		return err
 	}
-	
-	fmt.Println("Domain removed from Windows hosts file.")
+
+	fmt.Println("Domain removed from hosts file:", path)
 	return nil
 }
+
+// writeHostsFile replaces the hosts file content, using sudo when the file isn't writable
+// (e.g. /etc/hosts on native Linux). The Windows hosts file is guarded by Windows, not by
+// Linux permissions, so sudo can't help under WSL.
+func writeHostsFile(path string, content []byte) error {
+	err := os.WriteFile(path, content, 0644)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	if CurrentPlatform().Name() == PlatformWSL {
+		fmt.Println(Info("Updating " + path + " requires Windows administrator rights, run the terminal as Administrator and try again."))
+		return err
+	}
+	if os.Geteuid() == 0 {
+		return err
+	}
+
+	fmt.Println(Info("Updating " + path + " requires root, using sudo..."))
+	cmd := exec.Command("sudo", "tee", path)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
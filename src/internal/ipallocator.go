@@ -3,6 +3,7 @@ package internal
 import (
 	"bufio"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -41,6 +42,9 @@ func isReservedIPSuffix(octet int) bool {
 }
 
 func FindNextFreeIP(base string, used map[string]bool) (string, error) {
+	if ip := net.ParseIP(base); ip == nil || ip.To4() == nil {
+		return "", fmt.Errorf("%s %q is not an IPv4 address, check it with `dockdev config validate`", EnvProjectStartIP, base)
+	}
 	prefix := base[:strings.LastIndex(base, ".")]
 	start, _ := strconv.Atoi(base[strings.LastIndex(base, ".")+1:])
 
@@ -64,6 +68,48 @@ func FindNextFreeIP(base string, used map[string]bool) (string, error) {
 	return "", fmt.Errorf("no available IPs in subnet")
 }
 
+// nextServiceIPs picks free addresses for the keys that have none in ipMap yet.
+// Nothing is recorded, see recordServiceIPs.
+func nextServiceIPs(baseIP string, keys []string, ipMap map[string]string) (map[string]string, error) {
+	usedIPs, err := LoadUsedIPs(IPMapPath)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := map[string]string{}
+	for _, key := range keys {
+		if _, ok := ipMap[key]; ok {
+			continue
+		}
+		ip, err := FindNextFreeIP(baseIP, usedIPs)
+		if err != nil {
+			return nil, err
+		}
+		usedIPs[ip] = true
+		assigned[key] = ip
+	}
+	return assigned, nil
+}
+
+// recordServiceIPs appends service addresses of a project to .ipmap.env. The nginx
+// service is stored as "main" and recorded under the bare domain.
+func recordServiceIPs(domain string, keys []string, ips map[string]string) error {
+	for _, key := range keys {
+		ip, ok := ips[key]
+		if !ok {
+			continue
+		}
+		entry := domain
+		if key != "main" {
+			entry += "_" + key
+		}
+		if err := AppendIPMapping(IPMapPath, entry, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func AppendIPMapping(ipmapPath, domain, ip string) error {
 	f, err := os.OpenFile(ipmapPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
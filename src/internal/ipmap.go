@@ -29,8 +29,8 @@ func InsertIPMappingAtTop(filePath, key, ip string) error {
 	return os.WriteFile(filePath, []byte(strings.Join(final, "\n")+"\n"), 0644)
 }
 
-func ExtractIPKeysFromTemplate(path string) ([]string, error) {
-	content, err := os.ReadFile(path)
+func ExtractIPKeysFromTemplate(name string) ([]string, error) {
+	content, err := readTemplate(name)
 
 	if err != nil {
 		return nil, err
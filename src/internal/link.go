@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Link routes a local domain to an upstream dockdev didn't create, such as a process
+// running in WSL or another compose stack. Links have no domains/ project; they are
+// tracked in shared-services/links.json.
+type Link struct {
+	Domain    string    `json:"domain"`
+	Upstream  string    `json:"upstream"`
+	UseSSL    bool      `json:"use_ssl"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// linksPath returns the path of the links file
+func linksPath() string {
+	return filepath.Join(SharedServicesDir, LinksFile)
+}
+
+// loadLinks reads the links file, keyed by domain
+func loadLinks() (map[string]Link, error) {
+	links := map[string]Link{}
+	content, err := os.ReadFile(linksPath())
+	if os.IsNotExist(err) {
+		return links, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Link
+	if err := json.Unmarshal(content, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", linksPath(), err)
+	}
+	for _, link := range list {
+		links[link.Domain] = link
+	}
+	return links, nil
+}
+
+// saveLinks writes the links file sorted by domain
+func saveLinks(links map[string]Link) error {
+	list := make([]Link, 0, len(links))
+	for _, link := range links {
+		list = append(list, link)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Domain < list[j].Domain })
+
+	if err := CreateDirIfNotExist(SharedServicesDir); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(linksPath(), append(content, '\n'), 0644)
+}
+
+// parseUpstream checks that an upstream is an http(s) URL with a host
+func parseUpstream(raw string) (*url.URL, error) {
+	upstream, err := url.Parse(raw)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %q, use e.g. http://host.docker.internal:8080", raw)
+	}
+	if strings.ContainsAny(raw, " \t;{}\"'") {
+		return nil, fmt.Errorf("invalid upstream %q", raw)
+	}
+	return upstream, nil
+}
+
+// LinkCommand implements `dockdev link [<domain> <upstream> [--no-ssl]]`
+func LinkCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 {
+		return listLinks()
+	}
+	if len(parsed.Positional) < 2 {
+		return fmt.Errorf("usage: link <domain> <http://host:port> [--no-ssl] | link")
+	}
+
+	domain, raw := parsed.Positional[0], parsed.Positional[1]
+	if err := validateDomain(domain); err != nil {
+		return err
+	}
+	upstream, err := parseUpstream(raw)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(ProjectDir(domain)); err == nil {
+		return fmt.Errorf("%s is a dockdev project, links are for upstreams outside domains/", domain)
+	}
+
+	links, err := loadLinks()
+	if err != nil {
+		return err
+	}
+	link := Link{Domain: domain, Upstream: upstream.String(), UseSSL: !parsed.Has("no-ssl"), CreatedAt: time.Now()}
+	if existing, ok := links[domain]; ok {
+		fmt.Println(Info("Updating link"), Bold(domain), Info("(was "+existing.Upstream+")"))
+		link.CreatedAt = existing.CreatedAt
+	}
+
+	if err := EnsureDockerRunning(); err != nil {
+		return fmt.Errorf("Docker check failed: %w", err)
+	}
+
+	if link.UseSSL {
+		if err := ensureRootCA(CertsDir); err != nil {
+			return fmt.Errorf("SSL rootCA failed: %w", err)
+		}
+		if _, _, err := generateDomainCert(domain, CertsDir); err != nil {
+			return fmt.Errorf("Domain SSL generation failed: %w", err)
+		}
+	}
+
+	if upstream.Hostname() == "host.docker.internal" {
+		warnMissingHostGateway()
+	}
+
+	vars, err := templateVars()
+	if err != nil {
+		return err
+	}
+	data := TemplateData{
+		Domain: domain,
+		UseSSL: link.UseSSL,
+		Routes: []SiteRoute{{Path: "/", Upstream: link.Upstream, WebSocket: true}},
+		Vars:   vars,
+	}
+	if err := applySiteConf(data); err != nil {
+		return err
+	}
+
+	links[domain] = link
+	if err := saveLinks(links); err != nil {
+		return err
+	}
+	if err := CurrentPlatform().AddHostsEntry(domain); err != nil {
+		return err
+	}
+
+	scheme := "http://"
+	if link.UseSSL {
+		scheme = "https://"
+	}
+	fmt.Println(Success("Linked"), Bold(Highlight(scheme+domain)), Success("->"), Info(link.Upstream))
+	return nil
+}
+
+// UnlinkCommand implements `dockdev unlink <domain>`
+func UnlinkCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unlink <domain>")
+	}
+	domain := args[0]
+
+	links, err := loadLinks()
+	if err != nil {
+		return err
+	}
+	if _, ok := links[domain]; !ok {
+		return fmt.Errorf("%s is not linked", domain)
+	}
+
+	siteConf := filepath.Join(SharedServicesDir, SitesDir, domain+".conf")
+	change := newProxyConfigChange()
+	if err := change.track(siteConf); err != nil {
+		return err
+	}
+	if err := os.Remove(siteConf); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Println(Success("Removed reverse proxy config:"), Info(siteConf))
+
+	if CheckDockerRunning() == nil {
+		if err := change.validate(); err != nil {
+			return err
+		}
+		if err := restartNginxReverseProxy(); err != nil {
+			fmt.Println(Warning("Warning: failed to reload Nginx reverse proxy:"), Error(err.Error()))
+		}
+	}
+
+	delete(links, domain)
+	if err := saveLinks(links); err != nil {
+		return err
+	}
+
+	certDir := filepath.Join(CertsDir, domain)
+	if err := os.RemoveAll(certDir); err != nil {
+		fmt.Println(Warning("Warning: failed to remove"), Info(certDir))
+	}
+	if err := CurrentPlatform().RemoveHostsEntry(domain); err != nil {
+		fmt.Println(Warning("Warning: failed to update hosts file:"), Error(err.Error()))
+	}
+
+	fmt.Println(Success("Unlinked"), Bold(domain))
+	return nil
+}
+
+// listLinks prints the linked domains
+func listLinks() error {
+	links, err := loadLinks()
+	if err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		fmt.Println(Info("No linked domains."))
+		return nil
+	}
+
+	var domains []string
+	for domain := range links {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	fmt.Println(Bold("Linked domains:"))
+	for _, domain := range domains {
+		link := links[domain]
+		ssl := ""
+		if !link.UseSSL {
+			ssl = Gray("(no SSL)")
+		}
+		fmt.Printf("  %-28s -> %s %s\n", domain, link.Upstream, ssl)
+	}
+	return nil
+}
+
+// warnMissingHostGateway points out shared compose files from before host.docker.internal
+// was mapped for the proxy. Docker Desktop resolves the name anyway, native Linux doesn't.
+func warnMissingHostGateway() {
+	content, err := os.ReadFile(filepath.Join(SharedServicesDir, DockerComposeFile))
+	if err != nil || strings.Contains(string(content), "host-gateway") {
+		return
+	}
+	fmt.Println(Warning("Note: the reverse proxy in"), Info(filepath.Join(SharedServicesDir, DockerComposeFile)),
+		Warning("has no host.docker.internal mapping."))
+	fmt.Println(Warning("On native Linux add this to the nginx-reverse-proxy service and recreate it:"))
+	fmt.Println(Gray(`    extra_hosts:
+      - "host.docker.internal:host-gateway"`))
+}
@@ -0,0 +1,365 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogsOptions controls which part of the logs is shown
+type LogsOptions struct {
+	Follow bool
+	Since  string
+	Tail   int
+}
+
+// logSource is a single container or log file that feeds the merged stream
+type logSource struct {
+	label     string
+	container string
+	path      string
+}
+
+// logPrinter serialises lines from several sources into one prefixed, colorized stream
+type logPrinter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	width  int
+	colors map[string]string
+}
+
+var logColors = []string{ColorGreen, ColorCyan, ColorYellow, ColorPurple, ColorBlue, ColorWhite}
+
+func newLogPrinter(out io.Writer, sources []logSource) *logPrinter {
+	p := &logPrinter{out: out, colors: map[string]string{}}
+	for i, s := range sources {
+		if len(s.label) > p.width {
+			p.width = len(s.label)
+		}
+		p.colors[s.label] = logColors[i%len(logColors)]
+	}
+	return p
+}
+
+func (p *logPrinter) print(label, line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prefix := fmt.Sprintf("%-*s |", p.width, label)
+	fmt.Fprintln(p.out, ColoredMessage(p.colors[label], prefix), line)
+}
+
+// LogsCommand implements `dockdev logs <domain|proxy> [service...] [-f] [--since] [--tail]`
+func LogsCommand(args []string) error {
+	parsed, err := parseArgs(args, "since", "tail")
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 {
+		return fmt.Errorf("usage: logs <domain|proxy> [service...] [-f] [--since 10m] [--tail 100]")
+	}
+
+	opts := LogsOptions{
+		Follow: parsed.Has("f") || parsed.Has("follow"),
+		Since:  parsed.Get("since", ""),
+		Tail:   DefaultLogTail,
+	}
+	if tail := parsed.Get("tail", ""); tail != "" {
+		if opts.Tail, err = strconv.Atoi(tail); err != nil || opts.Tail < 0 {
+			return fmt.Errorf("invalid --tail value: %s", tail)
+		}
+	}
+
+	target := parsed.Positional[0]
+	services := parsed.Positional[1:]
+
+	var sources []logSource
+	if target == "proxy" {
+		sources, err = proxyLogSources()
+	} else {
+		sources, err = projectLogSources(target, services)
+	}
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no logs found for %s", target)
+	}
+
+	if opts.Since != "" {
+		fmt.Println(Gray("Note: --since applies to container output only, log files show the last lines."))
+	}
+
+	return streamLogs(os.Stdout, sources, opts)
+}
+
+// projectLogSources collects the containers and log files of a project, optionally filtered by service
+func projectLogSources(domain string, services []string) ([]logSource, error) {
+	projectDir := filepath.Join(ProjectDirPrefix, domain)
+	if !hasComposeStack(projectDir) {
+		return nil, fmt.Errorf("project not found: %s", domain)
+	}
+
+	wanted := func(service string) bool {
+		if len(services) == 0 {
+			return true
+		}
+		for _, s := range services {
+			if s == service {
+				return true
+			}
+		}
+		return false
+	}
+
+	var sources []logSource
+	if err := CheckDockerRunning(); err != nil {
+		fmt.Println(Warning("Docker is not available, showing log files only."))
+	} else {
+		statuses, err := composeServiceStatuses(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range statuses {
+			if wanted(s.Service) {
+				sources = append(sources, logSource{label: s.Service, container: s.Name})
+			}
+		}
+	}
+
+	files, err := logFiles(filepath.Join(projectDir, "logs"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		service := logFileService(projectDir, f)
+		if wanted(service) {
+			sources = append(sources, logSource{label: service + ":" + filepath.Base(f), path: f})
+		}
+	}
+
+	return sources, nil
+}
+
+// proxyLogSources collects the reverse proxy container and its log files
+func proxyLogSources() ([]logSource, error) {
+	var sources []logSource
+	if err := CheckDockerRunning(); err != nil {
+		fmt.Println(Warning("Docker is not available, showing log files only."))
+	} else {
+		sources = append(sources, logSource{label: "proxy", container: ReverseProxyName})
+	}
+
+	files, err := logFiles(filepath.Join(SharedServicesDir, "logs", "nginx"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		sources = append(sources, logSource{label: "proxy:" + filepath.Base(f), path: f})
+	}
+	return sources, nil
+}
+
+// logFiles returns all *.log files below dir
+func logFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".log") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// logFileService maps a file under <project>/logs to the service that writes it.
+// Files live in logs/<service>/, except the PHP error log that sits next to the nginx logs.
+func logFileService(projectDir, path string) string {
+	if strings.HasSuffix(path, "_php_error.log") {
+		return "php"
+	}
+	rel, err := filepath.Rel(filepath.Join(projectDir, "logs"), path)
+	if err != nil {
+		return "logs"
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 {
+		return "logs"
+	}
+	return parts[0]
+}
+
+// streamLogs prints all sources into one stream and returns when every source is done
+func streamLogs(out io.Writer, sources []logSource, opts LogsOptions) error {
+	printer := newLogPrinter(out, sources)
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(s logSource) {
+			defer wg.Done()
+			emit := func(line string) { printer.print(s.label, line) }
+
+			var err error
+			if s.container != "" {
+				err = streamContainerLogs(s.container, opts, emit)
+			} else {
+				err = streamLogFile(s.path, opts, emit)
+			}
+			if err != nil {
+				emit(Error(err.Error()))
+			}
+		}(source)
+	}
+	wg.Wait()
+	return nil
+}
+
+// streamContainerLogs passes `docker logs` output of a container line by line to emit
+func streamContainerLogs(container string, opts LogsOptions, emit func(string)) error {
+	args := []string{"logs", "--tail", strconv.Itoa(opts.Tail)}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if opts.Since != "" {
+		args = append(args, "--since", opts.Since)
+	}
+	args = append(args, container)
+
+	cmd := exec.Command("docker", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func(r io.Reader) {
+			defer wg.Done()
+			scanner := bufio.NewScanner(r)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				emit(scanner.Text())
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	return cmd.Wait()
+}
+
+// streamLogFile emits the last lines of a file and, when following, everything appended afterwards
+func streamLogFile(path string, opts LogsOptions, emit func(string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	// file is reopened when the log is rotated, close whichever is current
+	defer func() { file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Only the end of the file is needed for the tail, big access logs are common
+	offset := info.Size() - LogFileTailWindow
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	// Follow from what was actually read, lines written meanwhile come with the next poll
+	position, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	// The last part is a line still being written, or empty after a trailing newline
+	partial := lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	if offset > 0 && len(lines) > 0 {
+		// The first line is most likely cut in the middle
+		lines = lines[1:]
+	}
+	if !opts.Follow && partial != "" {
+		lines = append(lines, partial)
+	}
+	if len(lines) > opts.Tail {
+		lines = lines[len(lines)-opts.Tail:]
+	}
+	for _, line := range lines {
+		emit(line)
+	}
+
+	if !opts.Follow {
+		return nil
+	}
+
+	for {
+		time.Sleep(LogFilePollInterval)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.Size() < position {
+			// File was truncated or rotated, start over with whatever is at the path now
+			reopened, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			file.Close()
+			file = reopened
+			position = 0
+			partial = ""
+		}
+		if info.Size() == position {
+			continue
+		}
+
+		if _, err := file.Seek(position, io.SeekStart); err != nil {
+			return err
+		}
+		chunk := make([]byte, info.Size()-position)
+		n, err := io.ReadFull(file, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		position += int64(n)
+
+		data := partial + string(chunk[:n])
+		parts := strings.Split(data, "\n")
+		partial = parts[len(parts)-1]
+		for _, line := range parts[:len(parts)-1] {
+			emit(line)
+		}
+	}
+}
@@ -1,33 +1,140 @@
 package internal
 
 import (
+    "io"
     "os"
     "os/exec"
     "fmt"
+    "strings"
     "time"
 )
 
-func waitForMySQL(container, rootPass string) error {
+// mysqlEngine serves MySQL and MariaDB, which only differ in container and binary names
+type mysqlEngine struct {
+	name      string
+	container string
+	rootPass  string
+	client    string // mysql or mariadb
+	dump      string // mysqldump or mariadb-dump
+}
+
+func (e *mysqlEngine) Name() string {
+	return e.name
+}
+
+func (e *mysqlEngine) Container() string {
+	return e.container
+}
+
+// IdentifierLimit returns the MySQL limits for schemas (64) and users (32)
+func (e *mysqlEngine) IdentifierLimit() (int, int) {
+	return 64, 32
+}
+
+func (e *mysqlEngine) WaitReady() error {
 	for i := 1; i <= 30; i++ {
-		cmd := exec.Command("docker", "exec", container,
-			"mysql", "-uroot", fmt.Sprintf("-p%s", rootPass),
-			"-e", "SELECT 1;")
+		cmd := e.rootCommand(e.client, "-e", "SELECT 1;")
 
 		if err := cmd.Run(); err == nil {
-			fmt.Println("MySQL is ready.")
+			fmt.Printf("%s is ready.\n", e.name)
 			return nil
 		}
 
-		fmt.Printf("Waiting for MySQL... (%d/30)\n", i)
+		fmt.Printf("Waiting for %s... (%d/30)\n", e.name, i)
 		time.Sleep(2 * time.Second)
 	}
-	return fmt.Errorf("MySQL is not responding in container: %s", container)
+	return fmt.Errorf("%s is not responding in container: %s", e.name, e.container)
 }
 
-func grantAllPrivileges(container, rootPass, user string) error {
-	sql := fmt.Sprintf(`GRANT ALL PRIVILEGES ON *.* TO '%s'@'%%' WITH GRANT OPTION;`, user)
-	cmd := exec.Command("docker", "exec", "-i", container, "mysql", "-uroot", fmt.Sprintf("-p%s", rootPass), "-e", sql)
+// rootCommand runs a client tool as root. The root password is passed in MYSQL_PWD,
+// which both MySQL and MariaDB tools read, so it stays out of process listings.
+func (e *mysqlEngine) rootCommand(tool string, args ...string) *exec.Cmd {
+	command := append([]string{tool, "-uroot"}, args...)
+	return dockerExec(e.container, map[string]string{"MYSQL_PWD": e.rootPass}, command...)
+}
+
+// runScript runs SQL statements as root. The statements are sent on stdin so
+// project passwords don't show up in the process list.
+func (e *mysqlEngine) runScript(sql string) error {
+	cmd := e.rootCommand(e.client)
+	cmd.Stdin = strings.NewReader(sql)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// mysqlQuote escapes a value for use inside a single quoted SQL string
+func mysqlQuote(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
+
+// Provision creates the project schema and a user that can only access it
+func (e *mysqlEngine) Provision(db *DatabaseState) error {
+	sql := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;\n", db.Name) +
+		fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED BY '%s';\n", db.User, mysqlQuote(db.Password)) +
+		fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY '%s';\n", db.User, mysqlQuote(db.Password)) +
+		fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'%%';\n", db.Name, db.User) +
+		"FLUSH PRIVILEGES;\n"
+	return e.runScript(sql)
+}
+
+// Drop removes the project schema and its user
+func (e *mysqlEngine) Drop(db *DatabaseState) error {
+	sql := fmt.Sprintf("DROP DATABASE IF EXISTS `%s`;\n", db.Name) +
+		fmt.Sprintf("DROP USER IF EXISTS '%s'@'%%';\n", db.User) +
+		"FLUSH PRIVILEGES;\n"
+	return e.runScript(sql)
+}
+
+// Reset drops and recreates the project schema. The user's grants on the
+// schema survive the drop, so no re-provisioning is needed.
+func (e *mysqlEngine) Reset(db *DatabaseState) error {
+	sql := fmt.Sprintf("DROP DATABASE IF EXISTS `%s`;\n", db.Name) +
+		fmt.Sprintf("CREATE DATABASE `%s` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;\n", db.Name)
+	return e.runScript(sql)
+}
+
+// Dump writes an SQL dump of the project schema to w
+func (e *mysqlEngine) Dump(db *DatabaseState, w io.Writer) error {
+	cmd := e.rootCommand(e.dump, "--single-transaction", "--routines", "--triggers", "--events", db.Name)
+	cmd.Stdout = w
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", e.dump, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Restore feeds an SQL dump from r into the project schema
+func (e *mysqlEngine) Restore(db *DatabaseState, r io.Reader) error {
+	cmd := e.rootCommand(e.client, db.Name)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("import failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Client connects as the project user; the password is passed through MYSQL_PWD
+func (e *mysqlEngine) Client(db *DatabaseState, args []string) execOptions {
+	return execOptions{
+		Container: e.container,
+		SecretEnv: map[string]string{"MYSQL_PWD": db.Password},
+		Command:   append([]string{e.client, "-u" + db.User, "--database=" + db.Name}, args...),
+	}
+}
+
+func (e *mysqlEngine) AppEnv(db *DatabaseState) []EnvValue {
+	return []EnvValue{
+		{Key: "DB_CONNECTION", Value: e.name},
+		{Key: "DB_HOST", Value: e.container},
+		{Key: "DB_PORT", Value: DatabasePort},
+		{Key: "DB_DATABASE", Value: db.Name},
+		{Key: "DB_USERNAME", Value: db.User},
+		{Key: "DB_PASSWORD", Value: db.Password},
+	}
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// validateDomain checks a domain before it ends up in file names, the proxy config, the
+// certificate and the hosts file: dot separated labels of the form subdomainPattern accepts
+func validateDomain(domain string) error {
+	if domain == "" || len(domain) > 253 {
+		return fmt.Errorf("invalid domain %q", domain)
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) > 63 || !subdomainPattern.MatchString(label) {
+			return fmt.Errorf("invalid domain %q: use lowercase letters, digits and dashes, separated by dots", domain)
+		}
+	}
+	return nil
+}
+
+// projectPrefix derives the container name prefix from the full domain, so that
+// app.test and app.local don't share container names: app.test -> app_test
+func projectPrefix(domain string) string {
+	return strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(domain), "_"), "_")
+}
+
+// composeProjectName returns the explicit compose project name for a project prefix.
+// Without it compose falls back to the directory name.
+func composeProjectName(prefix string) string {
+	return ComposeProjectPrefix + prefix
+}
+
+// databaseIdentifier shortens a name to the engine limit for databases or users.
+// Long names keep a hash of the full name so they stay unique.
+func databaseIdentifier(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+	sum := sha1.Sum([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:])[:8]
+	return name[:limit-len(suffix)] + suffix
+}
+
+// newProjectDatabase returns the database, user and a fresh password for a project prefix
+func newProjectDatabase(engine DatabaseEngine, prefix string) (*DatabaseState, error) {
+	password, err := randomPassword(DatabasePasswordLength)
+	if err != nil {
+		return nil, err
+	}
+	nameLimit, userLimit := engine.IdentifierLimit()
+	return &DatabaseState{
+		Engine:   engine.Name(),
+		Name:     databaseIdentifier(prefix, nameLimit),
+		User:     databaseIdentifier(prefix, userLimit),
+		Password: password,
+	}, nil
+}
+
+// randomPassword returns a random alphanumeric string
+func randomPassword(length int) (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	result := make([]byte, length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		result[i] = alphabet[n.Int64()]
+	}
+	return string(result), nil
+}
+
+// plannedContainerNames renders the compose template and returns the container names it declares
+func plannedContainerNames(templateName string, data TemplateData) ([]string, error) {
+	tmpl, err := parseTemplate(templateName, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+
+	regex := regexp.MustCompile(`(?m)^\s*container_name:\s*["']?([^"'\s]+)`)
+	var names []string
+	for _, m := range regex.FindAllStringSubmatch(rendered.String(), -1) {
+		names = append(names, m[1])
+	}
+	return names, nil
+}
+
+// checkNameConflicts fails if another project already uses the prefix, or if containers
+// with the planned names or compose project name already exist
+func checkNameConflicts(data TemplateData, containerNames []string) error {
+	projects, err := ListExistingProjects()
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		if project == data.Domain {
+			continue
+		}
+		state, err := LoadProjectState(project)
+		if err != nil {
+			continue
+		}
+		if state.Prefix == data.Prefix {
+			return fmt.Errorf("project %s already uses the container prefix %q", project, data.Prefix)
+		}
+	}
+
+	output, err := exec.Command("docker", "ps", "--all", "--format",
+		`{{.Names}}\t{{.Label "com.docker.compose.project"}}`).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	planned := make(map[string]bool, len(containerNames))
+	for _, name := range containerNames {
+		planned[name] = true
+	}
+
+	var conflicts []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if fields[0] == "" {
+			continue
+		}
+		name, project := fields[0], ""
+		if len(fields) == 2 {
+			project = fields[1]
+		}
+		if planned[name] {
+			conflicts = append(conflicts, fmt.Sprintf("container %s already exists", name))
+		} else if project == data.ProjectName {
+			conflicts = append(conflicts, fmt.Sprintf("container %s already belongs to compose project %s", name, project))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("name conflict for %s:\n  - %s\nRemove the containers or choose another domain",
+			data.Domain, strings.Join(conflicts, "\n  - "))
+	}
+	return nil
+}
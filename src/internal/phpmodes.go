@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PHPModes are the debugging and caching switches of a project's php-fpm, changed at
+// runtime with `dockdev php`. Empty values mean the image defaults.
+type PHPModes struct {
+	Xdebug    string `json:"xdebug,omitempty"`    // off, debug, profile or trace
+	Coverage  string `json:"coverage,omitempty"`  // pcov, xdebug or off
+	Opcache   string `json:"opcache,omitempty"`   // on or off
+	Blackfire string `json:"blackfire,omitempty"` // on or off
+}
+
+// withDefaults returns the modes with image defaults filled in
+func (m PHPModes) withDefaults() PHPModes {
+	if m.Xdebug == "" {
+		m.Xdebug = "off"
+	}
+	if m.Coverage == "" {
+		m.Coverage = "pcov"
+	}
+	if m.Opcache == "" {
+		m.Opcache = "on"
+	}
+	if m.Blackfire == "" {
+		m.Blackfire = "off"
+	}
+	return m
+}
+
+// xdebugMode returns the xdebug.mode value, or "" when Xdebug isn't needed at all
+func (m PHPModes) xdebugMode() string {
+	var modes []string
+	switch m.Xdebug {
+	case "debug":
+		modes = append(modes, "develop", "debug")
+	case "profile":
+		modes = append(modes, "profile")
+	case "trace":
+		modes = append(modes, "trace")
+	}
+	if m.Coverage == "xdebug" {
+		modes = append(modes, "coverage")
+	}
+	return strings.Join(modes, ",")
+}
+
+// phpModeChoices lists the values each setting accepts
+var phpModeChoices = map[string][]string{
+	"xdebug":    {"on", "off", "profile", "trace"},
+	"coverage":  {"pcov", "xdebug", "off"},
+	"opcache":   {"on", "off"},
+	"blackfire": {"on", "off"},
+}
+
+// phpModesDir is the project directory php reads the mode ini files from, see
+// PHP_INI_SCAN_DIR in docker-compose.yml
+func phpModesDir(domain string) string {
+	return filepath.Join(ProjectDir(domain), "conf", "php", PHPModesDir)
+}
+
+// renderPHPModes writes one ini file per mode that differs from the image defaults.
+// Settings come from the project's conf/php/*.ini, so they can be edited there;
+// dockdev only adds the switches.
+func renderPHPModes(domain string, modes PHPModes) error {
+	dir := phpModesDir(domain)
+	if err := CreateDirIfNotExist(dir); err != nil {
+		return err
+	}
+	confDir := filepath.Dir(dir)
+
+	files := map[string]string{}
+	if mode := modes.xdebugMode(); mode != "" {
+		start := "yes"
+		if modes.Xdebug == "profile" || modes.Xdebug == "trace" {
+			// Profiling every request is slow, these start with an XDEBUG_TRIGGER cookie or parameter
+			start = "trigger"
+		}
+		files["xdebug.ini"] = "zend_extension=xdebug\n" + readPHPConf(confDir, "xdebug.ini") +
+			fmt.Sprintf("xdebug.mode=%s\nxdebug.start_with_request=%s\n", mode, start)
+	}
+	if modes.Coverage == "xdebug" || modes.Coverage == "off" {
+		files["pcov.ini"] = "pcov.enabled=0\n"
+	}
+	switch modes.Opcache {
+	case "on":
+		files["opcache.ini"] = readPHPConf(confDir, "opcache.ini") + "opcache.enable=1\n"
+	case "off":
+		files["opcache.ini"] = "opcache.enable=0\n"
+	}
+	if modes.Blackfire == "on" {
+		files["blackfire.ini"] = readPHPConf(confDir, "blackfire.ini")
+	}
+
+	for _, name := range []string{"xdebug.ini", "pcov.ini", "opcache.ini", "blackfire.ini"} {
+		path := filepath.Join(dir, name)
+		content, ok := files[name]
+		if !ok {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		header := "; Written by `dockdev php`, edit ../" + name + " instead\n"
+		if err := os.WriteFile(path, []byte(header+content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPHPConf returns a file of the project's conf/php directory, or "" if it's missing
+func readPHPConf(confDir, name string) string {
+	content, err := os.ReadFile(filepath.Join(confDir, name))
+	if err != nil {
+		return ""
+	}
+	text := string(content)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// ensurePHPExtension installs an extension into the running php container when the image
+// doesn't have it, and records it for the next image build
+func ensurePHPExtension(state *ProjectState, container, extension string) error {
+	check := fmt.Sprintf(`test -f "$(php -r 'echo ini_get("extension_dir");')/%s.so"`, extension)
+	if dockerExec(container, nil, "sh", "-c", check).Run() == nil {
+		return nil
+	}
+
+	if dockerExec(container, nil, "sh", "-c", "command -v install-php-extensions").Run() != nil {
+		return fmt.Errorf("%s is not installed and the image has no install-php-extensions, rebuild it with `dockdev set %s php-ext=%s --rebuild`",
+			extension, state.Domain, extension)
+	}
+
+	fmt.Println(Info("Installing"), Bold(extension), Info("into the running php container..."))
+	// The installer enables the extension for every request, dockdev's mode files load it instead
+	install := fmt.Sprintf("install-php-extensions %s && rm -f /usr/local/etc/php/conf.d/docker-php-ext-%s.ini", extension, extension)
+	cmd := dockerExec(container, nil, "sh", "-c", install)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to install %s: %w", extension, err)
+	}
+
+	// Keep it across container recreation by adding it to the image on the next build
+	stack := projectStack(state)
+	if !slices.Contains(stack.PHPExtensions, extension) {
+		stack.PHPExtensions = append(stack.PHPExtensions, extension)
+		if err := writeStackEnv(ProjectDir(state.Domain), stack); err != nil {
+			return err
+		}
+		state.Stack = &stack
+		fmt.Println(Info("Added"), Bold(extension), Info("to the image extensions, it is built in on the next rebuild."))
+	}
+	return nil
+}
+
+// reloadPHPFPM gracefully reloads php-fpm, which rereads the ini files. The master
+// process is found by its title, the entrypoint script runs as PID 1.
+func reloadPHPFPM(container string) error {
+	script := `for pid in $(pidof php-fpm); do if grep -q "master process" /proc/$pid/cmdline; then kill -USR2 $pid; exit 0; fi; done; exit 1`
+	if output, err := dockerExec(container, nil, "sh", "-c", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reload php-fpm in %s: %w %s", container, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// PHPCommand implements `dockdev php <domain> [status | xdebug on|off|profile|trace |
+// coverage pcov|xdebug|off | opcache on|off | blackfire on|off]`
+func PHPCommand(args []string) error {
+	usage := fmt.Errorf("usage: php <domain> [status] | php <domain> xdebug on|off|profile|trace | coverage pcov|xdebug|off | opcache on|off | blackfire on|off")
+	if len(args) == 0 {
+		return usage
+	}
+
+	domain := args[0]
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+	if err := state.requireGenerated("php"); err != nil {
+		return err
+	}
+	if len(args) == 1 || args[1] == "status" {
+		return showPHPModes(state)
+	}
+	if len(args) < 3 {
+		return usage
+	}
+
+	setting, value := args[1], args[2]
+	choices, ok := phpModeChoices[setting]
+	if !ok {
+		return usage
+	}
+	if !slices.Contains(choices, value) {
+		return fmt.Errorf("invalid %s mode %q (use %s)", setting, value, strings.Join(choices, ", "))
+	}
+
+	compose, err := os.ReadFile(filepath.Join(ProjectDir(domain), DockerComposeFile))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(compose), "PHP_INI_SCAN_DIR") {
+		return fmt.Errorf("the php service of %s predates `dockdev php`; add PHP_INI_SCAN_DIR and the %s mount of the built-in docker-compose.yml template first", domain, PHPModesDir)
+	}
+
+	// Only explicit choices are stored, so untouched modes keep following the image
+	modes := PHPModes{}
+	if state.PHPModes != nil {
+		modes = *state.PHPModes
+	}
+	switch setting {
+	case "xdebug":
+		if value == "on" {
+			value = "debug"
+		}
+		modes.Xdebug = value
+	case "coverage":
+		modes.Coverage = value
+	case "opcache":
+		modes.Opcache = value
+	case "blackfire":
+		modes.Blackfire = value
+	}
+
+	container, err := state.Container("php")
+	if err != nil {
+		return err
+	}
+	if modes.xdebugMode() != "" {
+		if err := ensurePHPExtension(state, container, "xdebug"); err != nil {
+			return err
+		}
+	}
+	if modes.Blackfire == "on" {
+		if err := ensurePHPExtension(state, container, "blackfire"); err != nil {
+			return err
+		}
+		if _, err := state.ServiceIP("blackfire"); err != nil {
+			fmt.Println(Warning("Note: blackfire.ini talks to a `blackfire` agent service, add one to docker-compose.yml."))
+		}
+	}
+
+	if err := renderPHPModes(domain, modes); err != nil {
+		return fmt.Errorf("failed to write php mode files: %w", err)
+	}
+	state.PHPModes = &modes
+	if err := SaveProjectState(state); err != nil {
+		return err
+	}
+	if err := reloadPHPFPM(container); err != nil {
+		return err
+	}
+
+	fmt.Println(Success("php-fpm reloaded:"), Bold(setting), Info(value))
+	if setting == "xdebug" && value != "off" {
+		fmt.Println(Info("Xdebug connects to your IDE on host.docker.internal:9003."))
+		if value != "debug" {
+			fmt.Println(Info("Start it with the XDEBUG_TRIGGER cookie or query parameter, output goes to storage/logs."))
+		}
+	}
+	return nil
+}
+
+// showPHPModes prints the configured modes next to what the php container actually loads
+func showPHPModes(state *ProjectState) error {
+	modes := PHPModes{}
+	if state.PHPModes != nil {
+		modes = *state.PHPModes
+	}
+	modes = modes.withDefaults()
+
+	var loaded struct {
+		Xdebug      bool   `json:"xdebug"`
+		XdebugMode  string `json:"xdebug_mode"`
+		Pcov        bool   `json:"pcov"`
+		PcovEnabled string `json:"pcov_enabled"`
+		Opcache     string `json:"opcache"`
+		Blackfire   bool   `json:"blackfire"`
+	}
+	live := false
+	if container, err := state.Container("php"); err == nil {
+		script := `echo json_encode([
+			"xdebug" => extension_loaded("xdebug"), "xdebug_mode" => (string) ini_get("xdebug.mode"),
+			"pcov" => extension_loaded("pcov"), "pcov_enabled" => (string) ini_get("pcov.enabled"),
+			"opcache" => (string) ini_get("opcache.enable"), "blackfire" => extension_loaded("blackfire"),
+		]);`
+		if output, err := dockerExec(container, nil, "php", "-r", script).Output(); err == nil {
+			live = json.Unmarshal(output, &loaded) == nil
+		}
+	}
+
+	fmt.Println(Bold("PHP modes of " + state.Domain + ":"))
+	row := func(name, value, actual string) {
+		if !live {
+			actual = Gray("(php container not running)")
+		}
+		fmt.Printf("  %-10s %-8s %s\n", name, value, actual)
+	}
+	row("xdebug", modes.Xdebug, loadedState(loaded.Xdebug, "xdebug.mode="+loaded.XdebugMode))
+	row("coverage", modes.Coverage, loadedState(loaded.Pcov, "pcov.enabled="+loaded.PcovEnabled))
+	row("opcache", modes.Opcache, Gray("opcache.enable="+loaded.Opcache))
+	row("blackfire", modes.Blackfire, loadedState(loaded.Blackfire, ""))
+	return nil
+}
+
+// loadedState describes whether an extension is loaded, with a detail when it is
+func loadedState(loaded bool, detail string) string {
+	if !loaded {
+		return Gray("not loaded")
+	}
+	if detail == "" {
+		return Success("loaded")
+	}
+	return Success("loaded") + " " + Gray(detail)
+}
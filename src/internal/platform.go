@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Platform hides the host specific parts of dockdev: where local domains are
+// registered, how the development CA is trusted, how URLs are opened and how
+// the Docker daemon is started.
+type Platform interface {
+	// Name returns the platform identifier used in the PLATFORM setting
+	Name() string
+	// HostsPath returns the hosts file that local domains are added to
+	HostsPath() string
+	// AddHostsEntry points domain to the local machine
+	AddHostsEntry(domain string) error
+	// RemoveHostsEntry removes the entries for domain
+	RemoveHostsEntry(domain string) error
+	// TrustRootCA adds the development root CA to the trust store used by browsers. Project
+	// certificates are issued by that CA, so they are never added to the trust store.
+	TrustRootCA(pemPath string) error
+	// OpenURL opens url in the default browser
+	OpenURL(url string) error
+	// StartDocker starts the Docker daemon and returns once it accepts commands
+	StartDocker() error
+}
+
+// Supported platform names
+const (
+	PlatformWSL   = "wsl"
+	PlatformLinux = "linux"
+)
+
+var (
+	currentPlatform     Platform
+	currentPlatformOnce sync.Once
+)
+
+// CurrentPlatform returns the platform dockdev runs on. The PLATFORM setting from
+// the environment or .env overrides the detection.
+func CurrentPlatform() Platform {
+	currentPlatformOnce.Do(func() {
+		// .env may not have been loaded yet, e.g. when deleting a project
+		loadConfig()
+
+		name := strings.ToLower(strings.TrimSpace(os.Getenv(EnvPlatform)))
+		if name == "" {
+			name = detectPlatform()
+		}
+
+		platform, err := platformByName(name)
+		if err != nil {
+			fmt.Println(Warning(fmt.Sprintf("Warning: %v, falling back to %s", err, detectPlatform())))
+			platform, _ = platformByName(detectPlatform())
+		}
+		currentPlatform = platform
+	})
+	return currentPlatform
+}
+
+// platformByName returns the implementation for a platform name
+func platformByName(name string) (Platform, error) {
+	switch name {
+	case PlatformWSL:
+		return &wslPlatform{}, nil
+	case PlatformLinux:
+		return &linuxPlatform{}, nil
+	}
+	return nil, fmt.Errorf("unknown platform %q (supported: %s, %s)", name, PlatformWSL, PlatformLinux)
+}
+
+// detectPlatform tells WSL apart from a native Linux installation
+func detectPlatform() string {
+	if os.Getenv("WSL_DISTRO_NAME") != "" || os.Getenv("WSL_INTEROP") != "" {
+		return PlatformWSL
+	}
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft") {
+		return PlatformWSL
+	}
+	return PlatformLinux
+}
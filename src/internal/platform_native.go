@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// linuxPlatform runs dockdev on a native Linux desktop with a system Docker daemon.
+// The file is not called platform_linux.go on purpose: that suffix is a GOOS build constraint.
+type linuxPlatform struct{}
+
+// caStore describes a distribution's system trust store
+type caStore struct {
+	dir    string
+	update []string
+}
+
+// linuxCAStores lists known trust store layouts: Debian/Ubuntu, Fedora/RHEL, Arch
+var linuxCAStores = []caStore{
+	{dir: "/usr/local/share/ca-certificates", update: []string{"update-ca-certificates"}},
+	{dir: "/etc/pki/ca-trust/source/anchors", update: []string{"update-ca-trust", "extract"}},
+	{dir: "/etc/ca-certificates/trust-source/anchors", update: []string{"trust", "extract-compat"}},
+}
+
+func (p *linuxPlatform) Name() string {
+	return PlatformLinux
+}
+
+func (p *linuxPlatform) HostsPath() string {
+	return LinuxHostsPath
+}
+
+func (p *linuxPlatform) AddHostsEntry(domain string) error {
+	return addHostsEntry(domain, p.HostsPath())
+}
+
+func (p *linuxPlatform) RemoveHostsEntry(domain string) error {
+	return removeHostsEntry(domain, p.HostsPath())
+}
+
+// TrustRootCA copies the root CA into the system trust store and refreshes it
+func (p *linuxPlatform) TrustRootCA(pemPath string) error {
+	store, err := findCAStore()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Importing rootCA.pem into the system trust store...")
+	dst := filepath.Join(store.dir, trustedCertFileName("rootCA"))
+	if err := runPrivileged("install", "-m", "0644", pemPath, dst); err != nil {
+		return fmt.Errorf("failed to copy root CA to %s: %w", store.dir, err)
+	}
+	if err := runPrivileged(store.update...); err != nil {
+		return fmt.Errorf("failed to update system trust store: %w", err)
+	}
+
+	fmt.Println(Info("Browsers with their own certificate database (e.g. Firefox) may need the CA imported manually:"), Highlight(pemPath))
+	return nil
+}
+
+// OpenURL opens url with the desktop's default handler
+func (p *linuxPlatform) OpenURL(url string) error {
+	for _, opener := range []string{"xdg-open", "sensible-browser"} {
+		if _, err := exec.LookPath(opener); err == nil {
+			cmd := exec.Command(opener, url)
+			// Don't wait for the browser, some openers block until it is closed
+			return cmd.Start()
+		}
+	}
+	return fmt.Errorf("no URL opener found (install xdg-utils)")
+}
+
+// StartDocker starts the Docker daemon through systemd
+func (p *linuxPlatform) StartDocker() error {
+	PrintSectionDivider("STARTING DOCKER")
+	fmt.Println(Highlight("Attempting to start the Docker service..."))
+
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return fmt.Errorf("systemctl not found, please start Docker manually")
+	}
+	if err := runPrivileged("systemctl", "start", "docker"); err != nil {
+		return fmt.Errorf("failed to start Docker service: %w", err)
+	}
+
+	PrintDivider()
+	fmt.Println(Info("Docker is starting. Please wait..."))
+	return waitForDockerDaemon()
+}
+
+// findCAStore returns the first trust store layout present on this system
+func findCAStore() (caStore, error) {
+	for _, store := range linuxCAStores {
+		if _, err := os.Stat(store.dir); err != nil {
+			continue
+		}
+		if _, err := exec.LookPath(store.update[0]); err != nil {
+			continue
+		}
+		return store, nil
+	}
+	return caStore{}, fmt.Errorf("no supported system trust store found")
+}
+
+// trustedCertFileName returns the file name dockdev uses for a certificate in the trust store
+func trustedCertFileName(name string) string {
+	return "dockdev-" + name + ".crt"
+}
+
+// runPrivileged runs a command as root, through sudo unless dockdev already runs as root
+func runPrivileged(args ...string) error {
+	if os.Geteuid() != 0 {
+		args = append([]string{"sudo"}, args...)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// wslPlatform runs dockdev inside WSL 2 with Docker Desktop and a Windows browser
+type wslPlatform struct{}
+
+func (p *wslPlatform) Name() string {
+	return PlatformWSL
+}
+
+func (p *wslPlatform) HostsPath() string {
+	return WindowsHostsPath
+}
+
+func (p *wslPlatform) AddHostsEntry(domain string) error {
+	return addHostsEntry(domain, p.HostsPath())
+}
+
+func (p *wslPlatform) RemoveHostsEntry(domain string) error {
+	return removeHostsEntry(domain, p.HostsPath())
+}
+
+// TrustRootCA imports the root CA into the Windows Root store with an elevated certutil
+func (p *wslPlatform) TrustRootCA(pemPath string) error {
+	fmt.Println("Importing rootCA.pem into Windows trusted store...")
+	// Use -NoProfile and -ExecutionPolicy Bypass to reduce memory usage and ensure clean exit
+	importCmd := exec.Command("powershell.exe", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command",
+		fmt.Sprintf(`Start-Process powershell -Verb runAs -ArgumentList '-NoProfile','-ExecutionPolicy','Bypass','-Command','certutil -addstore -f Root "%s"; exit'`,
+			convertToWindowsPath(pemPath)))
+	importCmd.Stdin = os.Stdin
+	importCmd.Stdout = os.Stdout
+	importCmd.Stderr = os.Stderr
+	err := importCmd.Run()
+
+	// Force garbage collection for PowerShell process
+	if importCmd.Process != nil {
+		importCmd.Process.Kill()
+	}
+
+	return err
+}
+
+// OpenURL opens url in the default Windows browser
+func (p *wslPlatform) OpenURL(url string) error {
+	// Use PowerShell to open the default browser
+	// Using Start-Process for better process management
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command",
+		fmt.Sprintf(`Start-Process "%s"`, url))
+	return cmd.Run()
+}
+
+// StartDocker starts Docker Desktop on Windows
+func (p *wslPlatform) StartDocker() error {
+	PrintSectionDivider("STARTING DOCKER DESKTOP")
+	fmt.Println(Highlight("Attempting to start Docker Desktop..."))
+
+	// Path to Docker Desktop on Windows
+	dockerPath := "C:\\Program Files\\Docker\\Docker\\Docker Desktop.exe"
+
+	// Check if Docker Desktop exists at the expected path
+	if _, err := os.Stat("/mnt/c/Program Files/Docker/Docker/Docker Desktop.exe"); os.IsNotExist(err) {
+		return fmt.Errorf("Docker Desktop not found at expected location")
+	}
+
+	// Start Docker Desktop
+	cmd := exec.Command("cmd.exe", "/c", "start", `"Docker Desktop"`, dockerPath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to start Docker Desktop: %w", err)
+	}
+
+	PrintDivider()
+	fmt.Println(Info("Docker Desktop is starting. Please wait..."))
+	return waitForDockerDaemon()
+}
+
+func convertToWindowsPath(wslPath string) string {
+	cmd := exec.Command("wslpath", "-w", wslPath)
+	out, err := cmd.Output()
+	if err != nil {
+		return wslPath
+	}
+	return string(out[:len(out)-1])
+}
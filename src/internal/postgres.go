@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// postgresEngine serves PostgreSQL. Connections over the container's local socket are
+// trusted by the official image, so root commands don't need the superuser password.
+type postgresEngine struct{}
+
+func (e *postgresEngine) Name() string {
+	return EnginePostgres
+}
+
+func (e *postgresEngine) Container() string {
+	return SharedPostgresName
+}
+
+// IdentifierLimit returns the PostgreSQL limit for database and role names (NAMEDATALEN - 1)
+func (e *postgresEngine) IdentifierLimit() (int, int) {
+	return 63, 63
+}
+
+func (e *postgresEngine) WaitReady() error {
+	for i := 1; i <= 30; i++ {
+		cmd := exec.Command("docker", "exec", SharedPostgresName,
+			"psql", "-U", "postgres", "-tAc", "SELECT 1;")
+
+		if err := cmd.Run(); err == nil {
+			fmt.Println("postgres is ready.")
+			return nil
+		}
+
+		fmt.Printf("Waiting for postgres... (%d/30)\n", i)
+		time.Sleep(2 * time.Second)
+	}
+	return fmt.Errorf("postgres is not responding in container: %s", SharedPostgresName)
+}
+
+// runScript runs SQL statements as the superuser, sent on stdin like the MySQL engine does
+func (e *postgresEngine) runScript(sql string) error {
+	cmd := exec.Command("docker", "exec", "-i", SharedPostgresName,
+		"psql", "-U", "postgres", "-v", "ON_ERROR_STOP=1", "-q")
+	cmd.Stdin = strings.NewReader(sql)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// pgIdent quotes an identifier
+func pgIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// pgQuote quotes a string literal
+func pgQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Provision creates a login role and a database owned by it. PUBLIC loses CONNECT on the
+// database so other project roles can't reach it.
+func (e *postgresEngine) Provision(db *DatabaseState) error {
+	createRole := fmt.Sprintf("CREATE ROLE %s LOGIN", pgIdent(db.User))
+	createDB := fmt.Sprintf("CREATE DATABASE %s OWNER %s ENCODING 'UTF8'", pgIdent(db.Name), pgIdent(db.User))
+
+	sql := fmt.Sprintf("SELECT %s WHERE NOT EXISTS (SELECT FROM pg_roles WHERE rolname = %s)\\gexec\n",
+		pgQuote(createRole), pgQuote(db.User)) +
+		fmt.Sprintf("ALTER ROLE %s WITH LOGIN PASSWORD %s;\n", pgIdent(db.User), pgQuote(db.Password)) +
+		fmt.Sprintf("SELECT %s WHERE NOT EXISTS (SELECT FROM pg_database WHERE datname = %s)\\gexec\n",
+			pgQuote(createDB), pgQuote(db.Name)) +
+		fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC;\n", pgIdent(db.Name))
+	return e.runScript(sql)
+}
+
+// Drop removes the project database and its role, closing open connections first
+func (e *postgresEngine) Drop(db *DatabaseState) error {
+	sql := fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE);\n", pgIdent(db.Name)) +
+		fmt.Sprintf("DROP ROLE IF EXISTS %s;\n", pgIdent(db.User))
+	return e.runScript(sql)
+}
+
+// Reset recreates the project database with the same owner
+func (e *postgresEngine) Reset(db *DatabaseState) error {
+	sql := fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE);\n", pgIdent(db.Name)) +
+		fmt.Sprintf("CREATE DATABASE %s OWNER %s ENCODING 'UTF8';\n", pgIdent(db.Name), pgIdent(db.User)) +
+		fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC;\n", pgIdent(db.Name))
+	return e.runScript(sql)
+}
+
+// Dump writes a plain SQL dump without ownership, so it can be restored under any role
+func (e *postgresEngine) Dump(db *DatabaseState, w io.Writer) error {
+	cmd := exec.Command("docker", "exec", SharedPostgresName, "pg_dump", "-U", "postgres",
+		"--no-owner", "--no-privileges", db.Name)
+	cmd.Stdout = w
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Restore loads a dump as the project role, so the restored objects belong to it
+func (e *postgresEngine) Restore(db *DatabaseState, r io.Reader) error {
+	cmd := exec.Command("docker", "exec", "-i", SharedPostgresName, "psql", "-U", db.User, "-d", db.Name,
+		"-v", "ON_ERROR_STOP=1", "-q")
+	cmd.Stdin = r
+	cmd.Stdout = io.Discard
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("import failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Client connects as the project role; the password is passed through PGPASSWORD
+func (e *postgresEngine) Client(db *DatabaseState, args []string) execOptions {
+	return execOptions{
+		Container: SharedPostgresName,
+		SecretEnv: map[string]string{"PGPASSWORD": db.Password},
+		Command:   append([]string{"psql", "-h", "127.0.0.1", "-U", db.User, "-d", db.Name}, args...),
+	}
+}
+
+func (e *postgresEngine) AppEnv(db *DatabaseState) []EnvValue {
+	return []EnvValue{
+		{Key: "DB_CONNECTION", Value: "pgsql"},
+		{Key: "DB_HOST", Value: SharedPostgresName},
+		{Key: "DB_PORT", Value: PostgresPort},
+		{Key: "DB_DATABASE", Value: db.Name},
+		{Key: "DB_USERNAME", Value: db.User},
+		{Key: "DB_PASSWORD", Value: db.Password},
+	}
+}
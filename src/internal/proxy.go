@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// proxyConfigChange remembers reverse proxy files as they were before dockdev rewrote
+// them, so a configuration nginx rejects can be put back before it takes the proxy down
+type proxyConfigChange struct {
+	files    []string
+	previous map[string][]byte // nil when the file didn't exist
+}
+
+func newProxyConfigChange() *proxyConfigChange {
+	return &proxyConfigChange{previous: map[string][]byte{}}
+}
+
+// track saves the current content of path. Call it before the file is written or removed.
+func (c *proxyConfigChange) track(path string) error {
+	if _, ok := c.previous[path]; ok {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.files = append(c.files, path)
+	c.previous[path] = content
+	return nil
+}
+
+// rollback restores every tracked file. Files are rewritten in place rather than replaced,
+// because nginx.conf is bind mounted as a single file and must keep its inode.
+func (c *proxyConfigChange) rollback() error {
+	var failed []string
+	for _, path := range c.files {
+		var err error
+		if content := c.previous[path]; content == nil {
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = os.WriteFile(path, content, 0644)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		fmt.Println(Warning("Restored previous"), Info(path))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to restore:\n  - %s", strings.Join(failed, "\n  - "))
+	}
+	return nil
+}
+
+// validate tests the proxy configuration and restores the tracked files if nginx rejects it
+func (c *proxyConfigChange) validate() error {
+	err := testProxyConfig()
+	var configErr *NginxConfigError
+	if !errors.As(err, &configErr) {
+		return err
+	}
+	if rollbackErr := c.rollback(); rollbackErr != nil {
+		return fmt.Errorf("%w\n%v", err, rollbackErr)
+	}
+	return err
+}
+
+// nginxLocation matches the file reference in nginx -t messages,
+// e.g. "unknown directive "foo" in /etc/nginx/sites/app.test.conf:12"
+var nginxLocation = regexp.MustCompile(`in (/etc/nginx/\S+?):(\d+)`)
+
+// proxyMounts maps proxy container paths to the shared-services paths mounted there
+var proxyMounts = []struct{ container, host string }{
+	{"/etc/nginx/nginx.conf", filepath.Join(SharedServicesDir, NginxConfFileName)},
+	{"/etc/nginx/sites", filepath.Join(SharedServicesDir, SitesDir)},
+	{"/etc/nginx/ssl", CertsDir},
+}
+
+// hostConfigPath translates a path inside the proxy container to the file on the host
+func hostConfigPath(path string) string {
+	for _, mount := range proxyMounts {
+		if path == mount.container || strings.HasPrefix(path, mount.container+"/") {
+			return mount.host + strings.TrimPrefix(path, mount.container)
+		}
+	}
+	return path
+}
+
+// NginxConfigError is returned when nginx rejects the reverse proxy configuration
+type NginxConfigError struct {
+	Output string // nginx -t output
+	File   string // host path of the offending file, empty if nginx didn't name one
+	Line   int
+	Source string // the offending line as it was when tested
+}
+
+func (e *NginxConfigError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("nginx rejected the reverse proxy configuration")
+	if e.File != "" {
+		fmt.Fprintf(&sb, " at %s:%d", e.File, e.Line)
+		if e.Source != "" {
+			fmt.Fprintf(&sb, "\n  %d | %s", e.Line, e.Source)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(e.Output), "\n") {
+		if strings.Contains(line, "[emerg]") || strings.Contains(line, "[error]") {
+			sb.WriteString("\n  " + nginxLocation.ReplaceAllStringFunc(line, func(match string) string {
+				m := nginxLocation.FindStringSubmatch(match)
+				return "in " + hostConfigPath(m[1]) + ":" + m[2]
+			}))
+		}
+	}
+	return sb.String()
+}
+
+// newNginxConfigError parses nginx -t output and reads the offending line from the host file
+func newNginxConfigError(output string) *NginxConfigError {
+	e := &NginxConfigError{Output: output}
+	m := nginxLocation.FindStringSubmatch(output)
+	if m == nil {
+		return e
+	}
+	e.File = hostConfigPath(m[1])
+	e.Line, _ = strconv.Atoi(m[2])
+	if content, err := os.ReadFile(e.File); err == nil {
+		lines := strings.Split(string(content), "\n")
+		if e.Line > 0 && e.Line <= len(lines) {
+			e.Source = strings.TrimSpace(lines[e.Line-1])
+		}
+	}
+	return e
+}
+
+// proxyRunning reports whether the reverse proxy container is running
+func proxyRunning() bool {
+	output, err := exec.Command("docker", "inspect", "-f", "{{.State.Running}}", ReverseProxyName).Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// testProxyConfig runs nginx -t against the files in shared-services. It uses the running
+// proxy when there is one, and a throwaway container with the same mounts otherwise.
+func testProxyConfig() error {
+	var cmd *exec.Cmd
+	if proxyRunning() {
+		cmd = exec.Command("docker", "exec", ReverseProxyName, "nginx", "-t", "-q")
+	} else {
+		if _, err := os.Stat(filepath.Join(SharedServicesDir, DockerComposeFile)); err != nil {
+			return nil
+		}
+		cmd = exec.Command("docker", "compose", "run", "--rm", "--no-deps", "-T", ReverseProxyName, "nginx", "-t", "-q")
+		cmd.Dir = SharedServicesDir
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	// Only a rejected configuration is worth a rollback, not a container that failed to start
+	if _, ok := err.(*exec.ExitError); !ok || !strings.Contains(string(output), "[emerg]") {
+		return fmt.Errorf("failed to test nginx configuration: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return newNginxConfigError(string(output))
+}
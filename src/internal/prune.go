@@ -0,0 +1,375 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pruneItem is a single leftover resource that can be removed
+type pruneItem struct {
+	kind   string
+	name   string
+	size   int64 // bytes, -1 when unknown
+	remove func() error
+}
+
+// PruneCommand implements `dockdev prune [--dry-run] [-y]`
+func PruneCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	dryRun := parsed.Has("dry-run")
+	assumeYes := parsed.Has("y") || parsed.Has("yes")
+
+	PrintSectionDivider("PRUNING ORPHANED RESOURCES")
+
+	owned, err := ownedDomains()
+	if err != nil {
+		return err
+	}
+
+	var items []pruneItem
+	if err := CheckDockerRunning(); err != nil {
+		fmt.Println(Warning("Docker is not available, only files will be checked."))
+	} else {
+		dockerItems, err := orphanedDockerResources(owned)
+		if err != nil {
+			return err
+		}
+		items = append(items, dockerItems...)
+	}
+
+	fileItems, err := orphanedFiles(owned)
+	if err != nil {
+		return err
+	}
+	items = append(items, fileItems...)
+
+	if len(items) == 0 {
+		fmt.Println(Success("Nothing to prune."))
+		return nil
+	}
+
+	var total int64
+	fmt.Println(Bold("Orphaned resources:"))
+	for _, item := range items {
+		size := Gray("size unknown")
+		if item.size >= 0 {
+			size = formatBytes(item.size)
+			total += item.size
+		}
+		fmt.Printf("  %-10s %s %s\n", item.kind, item.name, Gray("("+size+")"))
+	}
+	fmt.Println(Bold("Reclaimable:"), Highlight(formatBytes(total)))
+
+	if dryRun {
+		return nil
+	}
+
+	if !assumeYes {
+		if !IsTerminal() {
+			return fmt.Errorf("refusing to prune without confirmation, pass --yes")
+		}
+		if !YesNoPrompt(fmt.Sprintf("Remove these %d resources?", len(items)), false) {
+			fmt.Println(Info("Aborted."))
+			return nil
+		}
+	}
+
+	PrintDivider()
+	failed := 0
+	siteConfigRemoved := false
+	for _, item := range items {
+		if err := item.remove(); err != nil {
+			fmt.Println(Warning("Failed to remove "+item.kind+" "+item.name+":"), Error(err.Error()))
+			failed++
+			continue
+		}
+		fmt.Println(Success("Removed "+item.kind+":"), Info(item.name))
+		if item.kind == "site conf" {
+			siteConfigRemoved = true
+		}
+	}
+
+	if siteConfigRemoved && CheckDockerRunning() == nil {
+		if err := restartNginxReverseProxy(); err != nil {
+			fmt.Println(Warning("Warning: failed to reload Nginx reverse proxy:"), Error(err.Error()))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d resources could not be removed", failed)
+	}
+	PrintSectionDivider("OPERATION COMPLETE")
+	return nil
+}
+
+// ownedDomains returns the domains dockdev currently manages
+func ownedDomains() (map[string]bool, error) {
+	projects, err := ListExistingProjects()
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		owned[project] = true
+	}
+
+	// Linked domains have a cert and site conf but no project
+	links, err := loadLinks()
+	if err != nil {
+		return nil, err
+	}
+	for domain := range links {
+		owned[domain] = true
+	}
+	return owned, nil
+}
+
+// ownedComposeProjects returns the compose project names of the managed projects
+func ownedComposeProjects(owned map[string]bool) map[string]bool {
+	names := map[string]bool{SharedComposeProject: true}
+	for domain := range owned {
+		if state, err := LoadProjectState(domain); err == nil && state.ComposeProject != "" {
+			names[state.ComposeProject] = true
+		}
+	}
+	return names
+}
+
+// dockerLines runs a docker command and returns its non-empty output lines
+func dockerLines(args ...string) ([]string, error) {
+	output, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker %s failed: %w", strings.Join(args, " "), err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// isOrphanedOwner decides from the dockdev and compose labels whether a resource belongs to a
+// project that no longer exists. Resources without any dockdev marker are never touched.
+func isOrphanedOwner(domain, composeProject string, owned, ownedProjects map[string]bool) bool {
+	if domain != "" {
+		return !owned[domain]
+	}
+	if strings.HasPrefix(composeProject, ComposeProjectPrefix) {
+		return !ownedProjects[composeProject]
+	}
+	return false
+}
+
+// orphanedDockerResources finds containers, images, volumes and networks of deleted projects
+func orphanedDockerResources(owned map[string]bool) ([]pruneItem, error) {
+	ownedProjects := ownedComposeProjects(owned)
+	labelFormat := `{{index .Labels "com.dockdev.domain"}}` + "\t" + `{{index .Labels "com.docker.compose.project"}}`
+	var items []pruneItem
+
+	// Stopped containers
+	lines, err := dockerLines("ps", "--all", "--filter", "status=exited", "--filter", "status=created",
+		"--format", `{{.ID}}\t{{.Names}}\t{{.Label "com.dockdev.domain"}}\t{{.Label "com.docker.compose.project"}}`)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		f := strings.Split(line+"\t\t\t", "\t")
+		if isOrphanedOwner(f[2], f[3], owned, ownedProjects) {
+			id := f[0]
+			items = append(items, pruneItem{kind: "container", name: f[1], size: -1, remove: func() error {
+				return exec.Command("docker", "rm", id).Run()
+			}})
+		}
+	}
+
+	// Images built from the project image/ folders
+	lines, err = dockerLines("image", "ls", "--quiet", "--no-trunc")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, id := range lines {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		out, err := exec.Command("docker", "image", "inspect", "--format",
+			`{{.Size}}`+"\t"+`{{index .Config.Labels "com.dockdev.domain"}}`+"\t"+`{{index .Config.Labels "com.docker.compose.project"}}`+"\t"+`{{join .RepoTags ","}}`,
+			id).Output()
+		if err != nil {
+			continue
+		}
+		f := strings.Split(strings.TrimSpace(string(out))+"\t\t\t", "\t")
+		if !isOrphanedOwner(f[1], f[2], owned, ownedProjects) {
+			continue
+		}
+		size, _ := strconv.ParseInt(f[0], 10, 64)
+		name := f[3]
+		if name == "" {
+			name = strings.TrimPrefix(id, "sha256:")[:12]
+		}
+		imageID := id
+		items = append(items, pruneItem{kind: "image", name: name, size: size, remove: func() error {
+			return exec.Command("docker", "image", "rm", imageID).Run()
+		}})
+	}
+
+	// Dangling volumes
+	lines, err = dockerLines("volume", "ls", "--quiet", "--filter", "dangling=true")
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range lines {
+		out, err := exec.Command("docker", "volume", "inspect", "--format", labelFormat, volume).Output()
+		if err != nil {
+			continue
+		}
+		f := strings.Split(strings.TrimSpace(string(out))+"\t\t", "\t")
+		if isOrphanedOwner(f[0], f[1], owned, ownedProjects) {
+			name := volume
+			items = append(items, pruneItem{kind: "volume", name: name, size: -1, remove: func() error {
+				return exec.Command("docker", "volume", "rm", name).Run()
+			}})
+		}
+	}
+
+	// Networks without containers
+	lines, err = dockerLines("network", "ls", "--quiet")
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range lines {
+		out, err := exec.Command("docker", "network", "inspect", "--format",
+			labelFormat+"\t{{len .Containers}}\t{{.Name}}", network).Output()
+		if err != nil {
+			continue
+		}
+		f := strings.Split(strings.TrimSpace(string(out))+"\t\t\t\t", "\t")
+		if f[2] != "0" || !isOrphanedOwner(f[0], f[1], owned, ownedProjects) {
+			continue
+		}
+		name := f[3]
+		items = append(items, pruneItem{kind: "network", name: name, size: -1, remove: func() error {
+			return exec.Command("docker", "network", "rm", name).Run()
+		}})
+	}
+
+	return items, nil
+}
+
+// orphanedFiles finds cert folders, site confs and .ipmap.env lines without a project
+func orphanedFiles(owned map[string]bool) ([]pruneItem, error) {
+	var items []pruneItem
+
+	entries, err := os.ReadDir(CertsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || owned[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(CertsDir, entry.Name())
+		items = append(items, pruneItem{kind: "certs", name: path, size: dirSize(path), remove: func() error {
+			return os.RemoveAll(path)
+		}})
+	}
+
+	sitesDir := filepath.Join(SharedServicesDir, SitesDir)
+	entries, err = os.ReadDir(sitesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		domain := strings.TrimSuffix(entry.Name(), ".conf")
+		if entry.IsDir() || domain == entry.Name() || owned[domain] {
+			continue
+		}
+		path := filepath.Join(sitesDir, entry.Name())
+		items = append(items, pruneItem{kind: "site conf", name: path, size: dirSize(path), remove: func() error {
+			return os.Remove(path)
+		}})
+	}
+
+	content, err := os.ReadFile(IPMapPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		key := strings.SplitN(line, "=", 2)[0]
+		if strings.TrimSpace(line) == "" || ipMapKeyOwned(key, owned) {
+			continue
+		}
+		entry := line
+		items = append(items, pruneItem{kind: "ip entry", name: entry, size: int64(len(entry) + 1), remove: func() error {
+			return removeIPMapLine(entry)
+		}})
+	}
+
+	return items, nil
+}
+
+// ipMapKeyOwned reports whether an .ipmap.env key (domain or domain_service) belongs to a managed domain
+func ipMapKeyOwned(key string, owned map[string]bool) bool {
+	if strings.HasPrefix(key, "shared-") || owned[key] {
+		return true
+	}
+	for domain := range owned {
+		if strings.HasPrefix(key, domain+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// removeIPMapLine removes one exact line from .ipmap.env
+func removeIPMapLine(entry string) error {
+	content, err := os.ReadFile(IPMapPath)
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != entry {
+			kept = append(kept, line)
+		}
+	}
+	return os.WriteFile(IPMapPath, []byte(strings.Join(kept, "\n")), 0644)
+}
+
+// dirSize returns the total size of the files below path
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// formatBytes formats a byte count the way docker does, e.g. 1.2GB
+func formatBytes(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
@@ -0,0 +1,268 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServiceStatus describes a single compose service container as reported by `docker compose ps`
+type ServiceStatus struct {
+	Service  string `json:"Service"`
+	Name     string `json:"Name"`
+	State    string `json:"State"`
+	Health   string `json:"Health"`
+	ExitCode int    `json:"ExitCode"`
+}
+
+// IsReady reports whether the container is running and, if it has a healthcheck, healthy
+func (s ServiceStatus) IsReady() bool {
+	return s.State == "running" && (s.Health == "" || s.Health == "healthy")
+}
+
+// describe returns a short human readable state such as "running (healthy)"
+func (s ServiceStatus) describe() string {
+	state := s.State
+	if s.Health != "" {
+		state += " (" + s.Health + ")"
+	}
+	if s.State == "exited" {
+		state += fmt.Sprintf(" [exit code %d]", s.ExitCode)
+	}
+	return state
+}
+
+// composeServiceStatuses lists all containers of the compose project in dir
+func composeServiceStatuses(dir string) ([]ServiceStatus, error) {
+	cmd := composeCommand(dir, "ps", "--all", "--format", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query compose services in %s: %w", dir, err)
+	}
+
+	output = bytes.TrimSpace(output)
+	var statuses []ServiceStatus
+	if len(output) == 0 {
+		return statuses, nil
+	}
+
+	// Older compose releases print a JSON array, newer ones print one object per line
+	if output[0] == '[' {
+		if err := json.Unmarshal(output, &statuses); err != nil {
+			return nil, fmt.Errorf("failed to parse compose status: %w", err)
+		}
+		return statuses, nil
+	}
+
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var status ServiceStatus
+		if err := json.Unmarshal(line, &status); err != nil {
+			return nil, fmt.Errorf("failed to parse compose status: %w", err)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// waitForServicesReady polls the compose project in dir until every service is ready or the timeout expires
+func waitForServicesReady(dir string, timeout time.Duration) ([]ServiceStatus, error) {
+	deadline := time.Now().Add(timeout)
+	var statuses []ServiceStatus
+	var err error
+
+	for {
+		statuses, err = composeServiceStatuses(dir)
+		if err == nil && len(statuses) > 0 {
+			ready := 0
+			for _, s := range statuses {
+				if s.IsReady() {
+					ready++
+				}
+			}
+			if ready == len(statuses) {
+				fmt.Println(Success("All services are ready."))
+				return statuses, nil
+			}
+			fmt.Printf("Waiting for services... (%d/%d ready)\n", ready, len(statuses))
+		}
+
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("services did not become ready within %s", timeout)
+			}
+			return statuses, err
+		}
+		time.Sleep(ReadinessPollInterval)
+	}
+}
+
+// newProxyProbeClient returns an HTTP client that reaches domain through the reverse proxy
+// on the local machine and trusts the development root CA
+func newProxyProbeClient(domain string) (*http.Client, error) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort("127.0.0.1", port))
+		},
+	}
+
+	rootPem, err := os.ReadFile(filepath.Join(CertsDir, "rootCA.pem"))
+	if err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rootPem) {
+			return nil, fmt.Errorf("failed to parse development root CA")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, ServerName: domain}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   5 * time.Second,
+		// A redirect is a valid answer from the project, don't follow it
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+// probeProjectURL requests the project URL through the reverse proxy and returns the HTTP status
+func probeProjectURL(client *http.Client, url string) (int, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// waitForProjectURL polls the project URL until it answers with a non-5xx status or the timeout expires
+func waitForProjectURL(domain, url string, timeout time.Duration) (int, error) {
+	client, err := newProxyProbeClient(domain)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := probeProjectURL(client, url)
+		if err == nil && status < 500 {
+			fmt.Printf(Success("%s responded with HTTP %d.\n"), url, status)
+			return status, nil
+		}
+
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("%s responded with HTTP %d", url, status)
+			}
+			return status, err
+		}
+
+		if err != nil {
+			fmt.Printf("Waiting for %s... (%v)\n", url, err)
+		} else {
+			fmt.Printf("Waiting for %s... (HTTP %d)\n", url, status)
+		}
+		time.Sleep(ReadinessPollInterval)
+	}
+}
+
+// containerLogTail returns the last lines of a container's combined output
+func containerLogTail(container string, lines int) string {
+	cmd := exec.Command("docker", "logs", "--tail", fmt.Sprint(lines), container)
+	output, err := cmd.CombinedOutput()
+	if err != nil && len(output) == 0 {
+		return err.Error()
+	}
+	return strings.TrimRight(string(output), "\n")
+}
+
+// printReadinessReport shows per-service state, recent logs of failing containers and the HTTP probe result
+func printReadinessReport(statuses []ServiceStatus, url string, httpStatus int, httpErr error) {
+	PrintSectionDivider("READINESS REPORT")
+
+	fmt.Println(Bold("Services:"))
+	if len(statuses) == 0 {
+		fmt.Println("  " + Warning("No containers found for this project."))
+	}
+	for _, s := range statuses {
+		state := s.describe()
+		if s.IsReady() {
+			state = Success(state)
+		} else {
+			state = Error(state)
+		}
+		fmt.Printf("  %-12s %-24s %s\n", s.Service, Gray(s.Name), state)
+	}
+
+	for _, s := range statuses {
+		if s.IsReady() {
+			continue
+		}
+		PrintDivider()
+		fmt.Println(Bold("Recent logs for " + s.Name + ":"))
+		fmt.Println(Gray(containerLogTail(s.Name, ReadinessLogLines)))
+	}
+
+	PrintDivider()
+	switch {
+	case httpErr == nil:
+		fmt.Println(Bold("HTTP:"), Success(fmt.Sprintf("%s -> %d", url, httpStatus)))
+	case httpStatus != 0:
+		fmt.Println(Bold("HTTP:"), Error(fmt.Sprintf("%s -> %d", url, httpStatus)))
+	default:
+		fmt.Println(Bold("HTTP:"), Error(fmt.Sprintf("%s -> %v", url, httpErr)))
+	}
+}
+
+// waitForProjectReady waits for all project services to become healthy and for the
+// project URL to be reachable through the reverse proxy. On timeout it prints a report.
+func waitForProjectReady(domain, projectDir string) error {
+	PrintDivider()
+	fmt.Println(Bold("WAITING FOR PROJECT TO BECOME READY"))
+
+	deadline := time.Now().Add(ReadinessTimeout)
+	url := GetProjectURL(domain)
+
+	statuses, err := waitForServicesReady(projectDir, ReadinessTimeout)
+	if err != nil {
+		printReadinessReport(statuses, url, 0, fmt.Errorf("not probed, services are not ready"))
+		return fmt.Errorf("project services are not ready: %w", err)
+	}
+
+	// The HTTP probe gets whatever is left of the overall budget, but at least a few attempts
+	remaining := time.Until(deadline)
+	if remaining < 10*time.Second {
+		remaining = 10 * time.Second
+	}
+
+	httpStatus, err := waitForProjectURL(domain, url, remaining)
+	if err != nil {
+		if refreshed, statusErr := composeServiceStatuses(projectDir); statusErr == nil {
+			statuses = refreshed
+		}
+		printReadinessReport(statuses, url, httpStatus, err)
+		return fmt.Errorf("project is not reachable: %w", err)
+	}
+
+	return nil
+}
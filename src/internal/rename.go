@@ -0,0 +1,386 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// renameUndo collects how to revert the steps a rename has done so far
+type renameUndo struct {
+	steps []func() error
+}
+
+// add records how to revert the step that is about to run
+func (u *renameUndo) add(step func() error) {
+	u.steps = append(u.steps, step)
+}
+
+// run reverts the recorded steps, last first. Failures are reported and the rest still runs.
+func (u *renameUndo) run() {
+	for i := len(u.steps) - 1; i >= 0; i-- {
+		if err := u.steps[i](); err != nil {
+			fmt.Println(Warning("Rollback step failed:"), Error(err.Error()))
+		}
+	}
+}
+
+// RenameCommand implements `dockdev rename <domain> <new-domain>`
+func RenameCommand(args []string) error {
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) != 2 {
+		return fmt.Errorf("usage: rename <domain> <new-domain>")
+	}
+	return renameProject(parsed.Positional[0], parsed.Positional[1])
+}
+
+// renameProject moves a project to a new domain. The containers are recreated under the
+// new names, the database and the data in domains/<domain> are kept. Every step is
+// reverted when a later one fails.
+func renameProject(oldDomain, newDomain string) error {
+	state, err := LoadProjectState(oldDomain)
+	if err != nil {
+		return err
+	}
+	if newDomain == oldDomain {
+		return fmt.Errorf("%s already has that domain", oldDomain)
+	}
+	if err := validateDomain(newDomain); err != nil {
+		return err
+	}
+	oldDir, newDir := ProjectDir(oldDomain), ProjectDir(newDomain)
+	if _, err := os.Stat(newDir); err == nil {
+		return fmt.Errorf("Project already exists: %s", newDir)
+	}
+	if links, err := loadLinks(); err == nil {
+		if _, ok := links[newDomain]; ok {
+			return fmt.Errorf("%s is linked to %s, run `dockdev unlink %s` first", newDomain, links[newDomain].Upstream, newDomain)
+		}
+	}
+	if err := EnsureDockerRunning(); err != nil {
+		return fmt.Errorf("Docker check failed: %w", err)
+	}
+
+	renamed := *state
+	renamed.Domain = newDomain
+	renamed.Prefix = projectPrefix(newDomain)
+	renamed.Containers = nil
+
+	// Everything that can be checked is checked before the first change
+	var rewrites []templateOutput
+	if state.Adopted == nil {
+		renamed.ComposeProject = composeProjectName(renamed.Prefix)
+		if rewrites, err = renameTemplateOutputs(state, &renamed); err != nil {
+			return err
+		}
+		names, err := plannedContainerNames(DockerComposeFile+".tmpl", TemplateData{
+			Domain: newDomain, Prefix: renamed.Prefix, ProjectName: renamed.ComposeProject, NetworkName: os.Getenv(EnvNetworkName),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read %s template: %w", DockerComposeFile, err)
+		}
+		if err := checkNameConflicts(TemplateData{Domain: newDomain, Prefix: renamed.Prefix, ProjectName: renamed.ComposeProject}, names); err != nil {
+			return err
+		}
+	}
+
+	PrintSectionDivider("RENAMING PROJECT: " + oldDomain + " -> " + newDomain)
+	undo := &renameUndo{}
+	fail := func(err error) error {
+		PrintDivider()
+		fmt.Println(Warning("Rename failed, rolling back..."))
+		undo.run()
+		return fmt.Errorf("rename of %s to %s failed and was rolled back: %w", oldDomain, newDomain, err)
+	}
+
+	// The containers carry the old names, they are recreated after the move
+	if state.Adopted == nil {
+		if err := runDockerComposeDown(oldDir); err != nil {
+			return fail(err)
+		}
+		undo.add(func() error { return runDockerComposeUp(oldDir) })
+	}
+
+	fmt.Println(Info("Moving"), Highlight(oldDir), Info("to"), Highlight(newDir))
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return fail(err)
+	}
+	undo.add(func() error { return os.Rename(newDir, oldDir) })
+
+	// Files in the project and .ipmap.env are restored from their previous content
+	files := newProxyConfigChange()
+	undo.add(files.rollback)
+	if err := files.track(IPMapPath); err != nil {
+		return fail(err)
+	}
+	if err := renameIPMappings(oldDomain, newDomain); err != nil {
+		return fail(err)
+	}
+	if err := renameProjectFiles(files, state, &renamed, rewrites); err != nil {
+		return fail(err)
+	}
+
+	if renamed.UseSSL {
+		fmt.Println(Info("Issuing the certificate for"), Bold(newDomain))
+		undo.add(func() error {
+			return os.RemoveAll(filepath.Join(CertsDir, newDomain))
+		})
+		if err := renameCert(files, &renamed); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := renameSiteConf(undo, oldDomain, &renamed); err != nil {
+		return fail(err)
+	}
+
+	if state.Adopted == nil {
+		undo.add(func() error { return runDockerComposeDown(newDir) })
+		if err := runDockerComposeUp(newDir); err != nil {
+			return fail(err)
+		}
+	}
+
+	// With a secret store the password moves to the key of the new domain on save
+	if err := files.track(projectStatePath(newDomain)); err != nil {
+		return fail(err)
+	}
+	if renamed.Database != nil {
+		undo.add(func() error {
+			store, err := secretStore()
+			if err != nil || store == nil {
+				return err
+			}
+			return store.Delete(projectSecretKey(newDomain))
+		})
+	}
+	renamed.refreshContainers()
+	if err := SaveProjectState(&renamed); err != nil {
+		return fail(err)
+	}
+
+	hosts := append([]string{newDomain}, exposedHosts(&renamed)...)
+	undo.add(func() error {
+		for _, host := range hosts {
+			CurrentPlatform().RemoveHostsEntry(host)
+		}
+		return nil
+	})
+	for _, host := range hosts {
+		if err := CurrentPlatform().AddHostsEntry(host); err != nil {
+			return fail(err)
+		}
+	}
+
+	cleanupRenamedProject(state, newDomain)
+
+	PrintSectionDivider("OPERATION COMPLETE")
+	fmt.Println(Success("Renamed"), Bold(oldDomain), Success("to"), Bold(Highlight(GetProjectURL(newDomain))))
+	return nil
+}
+
+// renameTemplateOutputs returns the template based files of a project, and their upgrade
+// bases, with the domain change merged in. Local edits are kept; a file whose edits touch
+// the lines that change stops the rename.
+func renameTemplateOutputs(state, renamed *ProjectState) ([]templateOutput, error) {
+	before, err := renameTemplateData(state, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The same variables, so passwords generated by the first render aren't generated again
+	after, err := renameTemplateData(renamed, before.Vars)
+	if err != nil {
+		return nil, err
+	}
+
+	oldOutputs, err := projectTemplateOutputs(before)
+	if err != nil {
+		return nil, err
+	}
+	newOutputs, err := projectTemplateOutputs(after)
+	if err != nil {
+		return nil, err
+	}
+
+	root := ProjectDir(state.Domain)
+	var rewrites []templateOutput
+	for i, output := range newOutputs {
+		if bytes.Equal(oldOutputs[i].Content, output.Content) {
+			continue
+		}
+		for _, name := range []string{output.Path, path.Join(ProjectStateDir, UpgradeBaseDir, output.Path)} {
+			current, err := readOptional(filepath.Join(root, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, err
+			}
+			if current == nil {
+				continue
+			}
+			merged, conflicts, err := mergeThreeWay(current, oldOutputs[i].Content, output.Content)
+			if err != nil {
+				return nil, err
+			}
+			// A base from an older template may not take the change, the next upgrade merges it
+			if conflicts > 0 && name != output.Path {
+				continue
+			}
+			if conflicts > 0 {
+				return nil, fmt.Errorf("local edits of %s conflict with the new domain, change the lines with %s by hand or undo the edits first",
+					filepath.Join(root, filepath.FromSlash(name)), state.Domain)
+			}
+			rewrites = append(rewrites, templateOutput{Path: name, Content: merged})
+		}
+	}
+	return rewrites, nil
+}
+
+// renameTemplateData returns the data the project files are rendered with
+func renameTemplateData(state *ProjectState, vars map[string]string) (TemplateData, error) {
+	data, err := siteTemplateData(state)
+	if err != nil {
+		return TemplateData{}, err
+	}
+	data.NetworkName = os.Getenv(EnvNetworkName)
+	data.Stack = projectStack(state)
+	if vars != nil {
+		data.Vars = vars
+	}
+	return data, nil
+}
+
+// renameProjectFiles writes the merged template files into the moved project directory.
+// An adopted stack only has the domain in the comment of its override.
+func renameProjectFiles(files *proxyConfigChange, state, renamed *ProjectState, rewrites []templateOutput) error {
+	dir := ProjectDir(renamed.Domain)
+	if state.Adopted != nil {
+		override := filepath.Join(dir, AdoptOverrideFile)
+		content, err := os.ReadFile(override)
+		if err != nil {
+			return err
+		}
+		rewrites = []templateOutput{{
+			Path:    AdoptOverrideFile,
+			Content: []byte(strings.ReplaceAll(string(content), " "+state.Domain+".", " "+renamed.Domain+".")),
+		}}
+	}
+
+	for _, rewrite := range rewrites {
+		target := filepath.Join(dir, filepath.FromSlash(rewrite.Path))
+		if err := files.track(target); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, rewrite.Content, 0644); err != nil {
+			return err
+		}
+		fmt.Println(Success("Updated"), Info(target))
+	}
+	return nil
+}
+
+// renameCert issues the certificate of the new domain. Generated projects also get a
+// copy in their nginx ssl directory, which is restored on rollback.
+func renameCert(files *proxyConfigChange, state *ProjectState) error {
+	if state.Adopted != nil {
+		_, _, err := generateDomainCert(state.Domain, CertsDir, exposedHosts(state)...)
+		return err
+	}
+	sslDir := filepath.Join(ProjectDir(state.Domain), "conf", "nginx", "ssl")
+	for _, name := range []string{"cert.crt", "cert.key"} {
+		if err := files.track(filepath.Join(sslDir, name)); err != nil {
+			return err
+		}
+	}
+	return issueProjectCert(state)
+}
+
+// renameSiteConf replaces the site conf of the old domain with one for the new domain
+// and reloads the proxy
+func renameSiteConf(undo *renameUndo, oldDomain string, state *ProjectState) error {
+	oldConf := filepath.Join(SharedServicesDir, SitesDir, oldDomain+".conf")
+	change := newProxyConfigChange()
+	for _, path := range []string{
+		oldConf,
+		filepath.Join(SharedServicesDir, SitesDir, state.Domain+".conf"),
+		filepath.Join(SharedServicesDir, NginxConfFileName),
+	} {
+		if err := change.track(path); err != nil {
+			return err
+		}
+	}
+	undo.add(func() error {
+		if err := change.rollback(); err != nil {
+			return err
+		}
+		return restartNginxReverseProxy()
+	})
+
+	if err := os.Remove(oldConf); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Println(Success("Removed reverse proxy config:"), Info(oldConf))
+	return applyProxySite(state)
+}
+
+// renameIPMappings moves the .ipmap.env entries of a project to the new domain, keeping the addresses
+func renameIPMappings(oldDomain, newDomain string) error {
+	content, err := os.ReadFile(IPMapPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if rest, ok := strings.CutPrefix(line, oldDomain+"="); ok {
+			lines[i] = newDomain + "=" + rest
+		} else if rest, ok := strings.CutPrefix(line, oldDomain+"_"); ok {
+			lines[i] = newDomain + "_" + rest
+		}
+	}
+	return os.WriteFile(IPMapPath, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// cleanupRenamedProject removes what only the old domain used, once the rename succeeded,
+// and moves its backups and snapshots along. Failures are reported, they don't undo the rename.
+func cleanupRenamedProject(state *ProjectState, newDomain string) {
+	oldDomain := state.Domain
+	for _, host := range append([]string{oldDomain}, exposedHosts(state)...) {
+		if err := CurrentPlatform().RemoveHostsEntry(host); err != nil {
+			fmt.Println(Warning("Warning: failed to update hosts file:"), Error(err.Error()))
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(CertsDir, oldDomain)); err != nil {
+		fmt.Println(Warning("Warning: failed to remove"), Info(filepath.Join(CertsDir, oldDomain)))
+	}
+
+	if state.Database != nil {
+		if store, err := secretStore(); err == nil && store != nil {
+			if err := store.Delete(projectSecretKey(oldDomain)); err != nil {
+				fmt.Println(Warning("Warning: failed to remove the old database password entry:"), Error(err.Error()))
+			}
+		}
+	}
+
+	for _, dir := range []string{BackupsDir, SnapshotsDir} {
+		from, to := filepath.Join(dir, oldDomain), filepath.Join(dir, newDomain)
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		if _, err := os.Stat(to); err == nil {
+			fmt.Println(Warning("Warning:"), Info(to), Warning("exists, kept"), Info(from))
+			continue
+		}
+		if err := os.Rename(from, to); err != nil {
+			fmt.Println(Warning("Warning: failed to move"), Info(from), Warning(err.Error()))
+			continue
+		}
+		fmt.Println(Success("Moved"), Info(from), Success("to"), Info(to))
+	}
+}
@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Route sends requests under a path prefix to a port of one of the project's services
+type Route struct {
+	Path        string `json:"path"`
+	Service     string `json:"service"`
+	Port        int    `json:"port"`
+	WebSocket   bool   `json:"websocket,omitempty"`
+	Timeout     string `json:"timeout,omitempty"`       // nginx time, e.g. 300s
+	MaxBodySize string `json:"max_body_size,omitempty"` // nginx size, e.g. 100m
+}
+
+// SiteRoute is a route as rendered into the reverse proxy site conf
+type SiteRoute struct {
+	Path        string
+	Upstream    string // proxy_pass URL, e.g. http://10.0.100.12:5173
+	WebSocket   bool
+	Timeout     string
+	MaxBodySize string
+}
+
+// defaultRoute is used for "/" unless the project routes it elsewhere
+var defaultRoute = Route{Path: "/", Service: "nginx", Port: 80, WebSocket: true}
+
+var (
+	routePathPattern = regexp.MustCompile(`^/[^\s{};"'#]*$`)
+	nginxTimePattern = regexp.MustCompile(`^\d+(ms|s|m|h)?$`)
+	nginxSizePattern = regexp.MustCompile(`^\d+[kKmMgG]?$`)
+)
+
+// validate checks a route before it is rendered, so bad input can't produce a broken site conf
+func (r Route) validate(state *ProjectState) error {
+	if !routePathPattern.MatchString(r.Path) {
+		return fmt.Errorf("invalid route path %q: must start with / and contain no spaces, quotes, braces or semicolons", r.Path)
+	}
+	if _, err := state.ServiceIP(r.Service); err != nil {
+		return err
+	}
+	if r.Port < 1 || r.Port > 65535 {
+		return fmt.Errorf("invalid port %d", r.Port)
+	}
+	if r.Timeout != "" && !nginxTimePattern.MatchString(r.Timeout) {
+		return fmt.Errorf("invalid timeout %q, use e.g. 60s or 5m", r.Timeout)
+	}
+	if r.MaxBodySize != "" && !nginxSizePattern.MatchString(r.MaxBodySize) {
+		return fmt.Errorf("invalid body size %q, use e.g. 100m", r.MaxBodySize)
+	}
+	return nil
+}
+
+// siteRoutes returns the routes to render for a project, with the default "/" route
+// unless the project overrides it
+func siteRoutes(state *ProjectState) ([]SiteRoute, error) {
+	routes := state.Routes
+	if findRoute(routes, "/") < 0 {
+		routes = append([]Route{defaultRoute}, routes...)
+	}
+
+	var site []SiteRoute
+	for _, route := range routes {
+		ip, err := state.ServiceIP(route.Service)
+		if err != nil {
+			return nil, err
+		}
+		site = append(site, SiteRoute{
+			Path:        route.Path,
+			Upstream:    fmt.Sprintf("http://%s:%d", ip, route.Port),
+			WebSocket:   route.WebSocket,
+			Timeout:     route.Timeout,
+			MaxBodySize: route.MaxBodySize,
+		})
+	}
+	return site, nil
+}
+
+// findRoute returns the index of the route with the path, or -1
+func findRoute(routes []Route, path string) int {
+	for i, route := range routes {
+		if route.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// siteTemplateData returns the template data for the project's reverse proxy site conf
+func siteTemplateData(state *ProjectState) (TemplateData, error) {
+	routes, err := siteRoutes(state)
+	if err != nil {
+		return TemplateData{}, err
+	}
+	exposures, err := siteExposures(state)
+	if err != nil {
+		return TemplateData{}, err
+	}
+	vars, err := projectTemplateVars(state)
+	if err != nil {
+		return TemplateData{}, err
+	}
+	var appMount string
+	if state.Source != nil && state.Source.Mounted {
+		appMount = state.Source.Path
+	}
+	return TemplateData{
+		Domain:           state.Domain,
+		Prefix:           state.Prefix,
+		ProjectName:      state.ComposeProject,
+		IPsByService:     state.IPsByService,
+		UseSSL:           state.UseSSL,
+		Routes:           routes,
+		Exposures:        exposures,
+		Vars:             vars,
+		AppMount:         appMount,
+		DisabledServices: state.DisabledServices,
+	}, nil
+}
+
+// siteConfTemplate returns the site conf template for the project's SSL setting
+func siteConfTemplate(useSSL bool) string {
+	if useSSL {
+		return "site-ssl.conf.tmpl"
+	}
+	return "site.conf.tmpl"
+}
+
+// applyProxySite renders the project's site conf and reloads the proxy
+func applyProxySite(state *ProjectState) error {
+	data, err := siteTemplateData(state)
+	if err != nil {
+		return err
+	}
+	return applySiteConf(data)
+}
+
+// applySiteConf renders a site conf together with the shared nginx.conf it depends on,
+// tests them and reloads the proxy. Rejected files are restored.
+func applySiteConf(data TemplateData) error {
+	siteConf := filepath.Join(SharedServicesDir, SitesDir, data.Domain+".conf")
+	nginxConf := filepath.Join(SharedServicesDir, NginxConfFileName)
+	if err := CreateDirIfNotExist(filepath.Dir(siteConf)); err != nil {
+		return err
+	}
+
+	change := newProxyConfigChange()
+	if err := change.track(siteConf); err != nil {
+		return err
+	}
+	if err := change.track(nginxConf); err != nil {
+		return err
+	}
+
+	if err := RenderTemplate(path.Join(SharedServicesDir, NginxConfFileName+".tmpl"), nginxConf, data); err != nil {
+		return err
+	}
+	if err := RenderTemplate(siteConfTemplate(data.UseSSL), siteConf, data); err != nil {
+		_ = change.rollback()
+		return err
+	}
+
+	if err := CheckDockerRunning(); err != nil {
+		fmt.Println(Warning("Docker is not running, the proxy picks up the change on its next start."))
+		return nil
+	}
+	if err := change.validate(); err != nil {
+		return err
+	}
+	return restartNginxReverseProxy()
+}
+
+// RouteCommand implements `dockdev route add|rm|list`
+func RouteCommand(args []string) error {
+	usage := fmt.Errorf("usage: route add <domain> <path> <service>[:port] [--ws] [--timeout 60s] [--max-body 100m] | route rm <domain> <path> | route list <domain>")
+	parsed, err := parseArgs(args, "timeout", "max-body")
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) < 2 {
+		return usage
+	}
+
+	action, domain := parsed.Positional[0], parsed.Positional[1]
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		return listRoutes(state)
+
+	case "add":
+		if len(parsed.Positional) < 4 {
+			return usage
+		}
+		route := Route{
+			Path:        parsed.Positional[2],
+			Service:     parsed.Positional[3],
+			Port:        80,
+			WebSocket:   parsed.Has("ws"),
+			Timeout:     parsed.Get("timeout", ""),
+			MaxBodySize: parsed.Get("max-body", ""),
+		}
+		if service, port, ok := strings.Cut(route.Service, ":"); ok {
+			route.Service = service
+			if route.Port, err = strconv.Atoi(port); err != nil {
+				return fmt.Errorf("invalid port %q", port)
+			}
+		}
+		if err := route.validate(state); err != nil {
+			return err
+		}
+
+		previous := state.Routes
+		if i := findRoute(state.Routes, route.Path); i >= 0 {
+			state.Routes = append(append([]Route{}, state.Routes[:i]...), state.Routes[i+1:]...)
+			fmt.Println(Info("Replacing the existing route for"), Bold(route.Path))
+		}
+		state.Routes = append(state.Routes, route)
+		if err := applyProxySite(state); err != nil {
+			state.Routes = previous
+			return err
+		}
+		if err := SaveProjectState(state); err != nil {
+			return err
+		}
+		fmt.Println(Success("Route added:"), Bold(route.Path), Info("->"), Info(fmt.Sprintf("%s:%d", route.Service, route.Port)))
+		return nil
+
+	case "rm":
+		if len(parsed.Positional) < 3 {
+			return usage
+		}
+		path := parsed.Positional[2]
+		i := findRoute(state.Routes, path)
+		if i < 0 {
+			return fmt.Errorf("no route for %s in %s", path, domain)
+		}
+
+		previous := state.Routes
+		state.Routes = append(append([]Route{}, state.Routes[:i]...), state.Routes[i+1:]...)
+		if err := applyProxySite(state); err != nil {
+			state.Routes = previous
+			return err
+		}
+		if err := SaveProjectState(state); err != nil {
+			return err
+		}
+		fmt.Println(Success("Route removed:"), Bold(path))
+		return nil
+	}
+	return usage
+}
+
+// listRoutes prints the routes of a project, including the default one
+func listRoutes(state *ProjectState) error {
+	routes := state.Routes
+	if findRoute(routes, "/") < 0 {
+		routes = append([]Route{defaultRoute}, routes...)
+	}
+
+	fmt.Println(Bold("Routes for " + state.Domain + ":"))
+	for _, route := range routes {
+		var options []string
+		if route.WebSocket {
+			options = append(options, "websocket")
+		}
+		if route.Timeout != "" {
+			options = append(options, "timeout "+route.Timeout)
+		}
+		if route.MaxBodySize != "" {
+			options = append(options, "max body "+route.MaxBodySize)
+		}
+		fmt.Printf("  %-24s -> %-18s %s\n", route.Path, fmt.Sprintf("%s:%d", route.Service, route.Port), Gray(strings.Join(options, ", ")))
+	}
+	return nil
+}
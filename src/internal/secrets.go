@@ -0,0 +1,439 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// SecretStore keeps credentials outside of .env and the project state files
+type SecretStore interface {
+	Name() string
+	// Get returns the secret or an empty string when it isn't stored
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+}
+
+// Secret backends selectable with SECRETS_BACKEND
+const (
+	SecretsBackendEnv     = "env"     // root passwords in .env, project passwords in state.json
+	SecretsBackendFile    = "file"    // AES-GCM encrypted secrets.enc
+	SecretsBackendKeyring = "keyring" // Secret Service keyring through secret-tool
+)
+
+var cachedSecretStore SecretStore
+
+// secretStore returns the configured backend, or nil for the plain env backend
+func secretStore() (SecretStore, error) {
+	if cachedSecretStore != nil {
+		return cachedSecretStore, nil
+	}
+
+	loadConfig()
+
+	switch backend := strings.ToLower(os.Getenv(EnvSecretsBackend)); backend {
+	case "", SecretsBackendEnv:
+		return nil, nil
+	case SecretsBackendFile:
+		cachedSecretStore = &fileSecretStore{path: SecretsFile}
+	case SecretsBackendKeyring:
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return nil, fmt.Errorf("%s=keyring needs secret-tool (libsecret-tools)", EnvSecretsBackend)
+		}
+		cachedSecretStore = keyringSecretStore{}
+	default:
+		return nil, fmt.Errorf("unknown %s %q (supported: env, file, keyring)", EnvSecretsBackend, backend)
+	}
+	return cachedSecretStore, nil
+}
+
+// rootSecret returns a shared credential such as MYSQL_ROOT_PASSWORD. -o and the
+// environment win over the secret store, which wins over .env.
+func rootSecret(key string) string {
+	if value, _, ok := configOverride(key); ok {
+		return value
+	}
+	if store, err := secretStore(); err == nil && store != nil {
+		if value, err := store.Get(key); err == nil && value != "" {
+			return value
+		}
+	}
+	return os.Getenv(key)
+}
+
+// projectSecretKey names the stored database password of a project
+func projectSecretKey(domain string) string {
+	return "project/" + domain + "/db_password"
+}
+
+// fileSecretStore keeps secrets in a JSON map encrypted with AES-GCM. The key is derived
+// from DOCKDEV_SECRETS_PASSPHRASE, or a passphrase typed at the terminal.
+type fileSecretStore struct {
+	path       string
+	passphrase string
+	secrets    map[string]string
+}
+
+type encryptedSecrets struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func (s *fileSecretStore) Name() string {
+	return SecretsBackendFile
+}
+
+func (s *fileSecretStore) Get(key string) (string, error) {
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	return s.secrets[key], nil
+}
+
+func (s *fileSecretStore) Set(key, value string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.secrets[key] = value
+	return s.save()
+}
+
+func (s *fileSecretStore) Delete(key string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.secrets[key]; !ok {
+		return nil
+	}
+	delete(s.secrets, key)
+	return s.save()
+}
+
+// Keys returns the stored keys in sorted order
+func (s *fileSecretStore) Keys() ([]string, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key := range s.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *fileSecretStore) readPassphrase() error {
+	if s.passphrase != "" {
+		return nil
+	}
+	s.passphrase = os.Getenv(EnvSecretsPassphrase)
+	if s.passphrase == "" && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, Highlight("Secrets passphrase:")+" ")
+		input, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		s.passphrase = string(input)
+	}
+	if s.passphrase == "" {
+		return fmt.Errorf("%s=file needs a passphrase, set %s", EnvSecretsBackend, EnvSecretsPassphrase)
+	}
+	return nil
+}
+
+func (s *fileSecretStore) deriveKey(salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, s.passphrase, salt, SecretsKDFIterations, 32)
+}
+
+func (s *fileSecretStore) load() error {
+	if s.secrets != nil {
+		return nil
+	}
+	if err := s.readPassphrase(); err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.secrets = map[string]string{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file encryptedSecrets
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	key, err := s.deriveKey(file.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: wrong passphrase?", s.path)
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	s.secrets = secrets
+	return nil
+}
+
+// save encrypts the secrets with a fresh salt and nonce and replaces the file atomically
+func (s *fileSecretStore) save() error {
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+
+	file := encryptedSecrets{Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	key, err := s.deriveKey(file.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(content, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyringSecretStore uses the desktop keyring (GNOME Keyring, KWallet) via secret-tool
+type keyringSecretStore struct{}
+
+func (keyringSecretStore) Name() string {
+	return SecretsBackendKeyring
+}
+
+func (keyringSecretStore) Get(key string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", KeyringService, "key", key)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && stderr.Len() == 0 {
+		// secret-tool exits with 1 and no message when nothing is stored
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret-tool lookup failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+func (keyringSecretStore) Set(key, value string) error {
+	// secret-tool reads the secret from stdin, so it never appears in the process list
+	cmd := exec.Command("secret-tool", "store", "--label", "dockdev "+key, "service", KeyringService, "key", key)
+	cmd.Stdin = strings.NewReader(value)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool store failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (keyringSecretStore) Delete(key string) error {
+	// clear succeeds whether or not the secret exists
+	if output, err := exec.Command("secret-tool", "clear", "service", KeyringService, "key", key).CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool clear failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// writeSharedSecrets writes the root credentials of the enabled engines to
+// shared-services/secrets for compose to mount as /run/secrets/<name>. The directory
+// is private to the current user; the files stay world readable because the database
+// images read them as their own service user after dropping root.
+func writeSharedSecrets(engines map[string]bool) error {
+	dir := filepath.Join(SharedServicesDir, SharedSecretsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+
+	files := map[string]string{}
+	if engines[EngineMySQL] {
+		files["mysql_root_password"] = rootSecret(EnvMySQLRootPassword)
+		files["mysql_password"] = rootSecret(EnvMySQLPassword)
+	}
+	if engines[EngineMariaDB] {
+		files["mariadb_root_password"] = mariadbRootPassword()
+	}
+	if engines[EnginePostgres] {
+		files["postgres_password"] = rootSecret(EnvPostgresPassword)
+	}
+
+	for name, value := range files {
+		if value == "" {
+			return fmt.Errorf("no value for shared secret %s, set it in .env or with `dockdev secrets set`", name)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+			return err
+		}
+		if err := os.Chmod(path, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SecretsCommand implements `dockdev secrets set|rm|list|migrate`
+func SecretsCommand(args []string) error {
+	usage := fmt.Errorf("usage: secrets set <KEY> | secrets rm <KEY> | secrets list | secrets migrate")
+	if len(args) == 0 {
+		return usage
+	}
+
+	store, err := secretStore()
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return fmt.Errorf("secrets are kept in .env and state.json; set %s=file or %s=keyring to use a secret store",
+			EnvSecretsBackend, EnvSecretsBackend)
+	}
+
+	switch args[0] {
+	case "set":
+		if len(args) < 2 {
+			return usage
+		}
+		value, err := readSecretValue(args[1])
+		if err != nil {
+			return err
+		}
+		if err := store.Set(args[1], value); err != nil {
+			return err
+		}
+		fmt.Println(Success("Stored"), Bold(args[1]), Success("in the"), Info(store.Name()), Success("secret store."))
+		return nil
+
+	case "rm":
+		if len(args) < 2 {
+			return usage
+		}
+		if err := store.Delete(args[1]); err != nil {
+			return err
+		}
+		fmt.Println(Success("Removed"), Bold(args[1]))
+		return nil
+
+	case "list":
+		file, ok := store.(*fileSecretStore)
+		if !ok {
+			return fmt.Errorf("the keyring can't be listed, use your keyring manager (service %q)", KeyringService)
+		}
+		keys, err := file.Keys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Println("  " + key)
+		}
+		return nil
+
+	case "migrate":
+		return migrateSecrets(store)
+	}
+	return usage
+}
+
+// readSecretValue reads a secret without echo from the terminal, or from stdin when piped
+func readSecretValue(key string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, Highlight("Value for "+key+":")+" ")
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(value), err
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(os.Stdin); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\r\n"), nil
+}
+
+// migrateSecrets copies the shared passwords from .env and moves the project database
+// passwords out of state.json into the store
+func migrateSecrets(store SecretStore) error {
+	for _, key := range []string{EnvMySQLRootPassword, EnvMySQLPassword, EnvMariaDBRootPassword, EnvPostgresPassword} {
+		if value := os.Getenv(key); value != "" {
+			if err := store.Set(key, value); err != nil {
+				return err
+			}
+			fmt.Println(Success("Stored"), Bold(key), Gray("- you can now remove it from .env"))
+		}
+	}
+
+	projects, err := ListExistingProjects()
+	if err != nil {
+		return err
+	}
+	for _, domain := range projects {
+		content, err := os.ReadFile(projectStatePath(domain))
+		if err != nil {
+			continue
+		}
+		state := &ProjectState{}
+		if err := json.Unmarshal(content, state); err != nil || state.Database == nil || state.Database.Password == "" {
+			continue
+		}
+		// SaveProjectState stores the password and blanks it in the file
+		if err := SaveProjectState(state); err != nil {
+			return err
+		}
+		fmt.Println(Success("Moved database password of"), Bold(domain))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// AppSource is an existing codebase a project is created from with --from
+type AppSource struct {
+	Path    string `json:"path"`              // absolute path of the local directory or git repository
+	Branch  string `json:"branch,omitempty"`  // branch cloned with --branch, empty for the checked out one
+	Mounted bool   `json:"mounted,omitempty"` // bind-mounted in place with --mount instead of copied into app/
+	Copy    bool   `json:"-"`                 // copied as it is even from a git repository, with its untracked files
+}
+
+// optionalServices are the project services only enabled when the codebase needs them,
+// with the files that show it does
+var optionalServices = []struct {
+	Service string
+	Markers []string
+}{
+	{"php", []string{"composer.json", "*.php", "public/*.php"}},
+	{"node", []string{"package.json"}},
+}
+
+// resolve checks the source and makes its path absolute
+func (s *AppSource) resolve() error {
+	path, err := filepath.Abs(userPath(s.Path))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("--from %s is not a directory", s.Path)
+	}
+	s.Path = path
+
+	if s.Branch != "" {
+		if s.Mounted {
+			return fmt.Errorf("--branch clones the repository, it can't be combined with --mount")
+		}
+		if !s.isGitRepo() {
+			return fmt.Errorf("--branch needs a git repository, %s is not one", s.Path)
+		}
+	}
+	return nil
+}
+
+// isGitRepo reports whether the source is the top of a git working tree
+func (s *AppSource) isGitRepo() bool {
+	_, err := os.Stat(filepath.Join(s.Path, ".git"))
+	return err == nil
+}
+
+// populate fills appDir with the code: git repositories are cloned, other directories
+// copied. A mounted source is used in place and leaves appDir alone.
+func (s *AppSource) populate(appDir string) error {
+	if s.Mounted {
+		fmt.Println(Info("Mounting"), Highlight(s.Path), Info("as the app"))
+		return nil
+	}
+
+	if s.Copy || !s.isGitRepo() {
+		fmt.Println(Info("Copying"), Highlight(s.Path), Info("to"), Highlight(appDir))
+		return CopyDir(s.Path, appDir)
+	}
+
+	args := []string{"clone"}
+	if s.Branch != "" {
+		args = append(args, "--branch", s.Branch)
+	}
+	args = append(args, "--", s.Path, appDir)
+	fmt.Println(Info("Cloning"), Highlight(s.Path), Info("to"), Highlight(appDir))
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git clone of %s failed: %w", s.Path, err)
+	}
+	return nil
+}
+
+// detectDisabledServices returns the optional services the code in dir has no use for.
+// When none of them is recognised every service stays enabled.
+func detectDisabledServices(dir string) []string {
+	var enabled, disabled []string
+	for _, optional := range optionalServices {
+		if hasAnyFile(dir, optional.Markers) {
+			enabled = append(enabled, optional.Service)
+		} else {
+			disabled = append(disabled, optional.Service)
+		}
+	}
+
+	if len(enabled) == 0 {
+		fmt.Println(Warning("No PHP or Node.js code detected, all services are enabled"))
+		return nil
+	}
+	fmt.Println(Info("Detected services:"), Bold(strings.Join(enabled, ", ")))
+	return disabled
+}
+
+// hasAnyFile reports whether dir holds a file matching one of the patterns
+func hasAnyFile(dir string, patterns []string) bool {
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// filterExposures drops the exposures of disabled services
+func filterExposures(exposures []Exposure, disabled []string) []Exposure {
+	var kept []Exposure
+	for _, exposure := range exposures {
+		if !slices.Contains(disabled, exposure.Service) {
+			kept = append(kept, exposure)
+		}
+	}
+	return kept
+}
+
+// Enabled reports whether a service is part of the project: {{ if .Enabled "node" }}
+func (d TemplateData) Enabled(service string) bool {
+	return !slices.Contains(d.DisabledServices, service)
+}
+
+// AppDir returns the bind mount source of the app in docker-compose.yml
+func (d TemplateData) AppDir() string {
+	if d.AppMount != "" {
+		return d.AppMount
+	}
+	return "./app"
+}
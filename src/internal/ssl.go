@@ -1,10 +1,13 @@
 package internal
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 func ensureRootCA(certsDir string) error {
@@ -33,25 +36,12 @@ func ensureRootCA(certsDir string) error {
 		return fmt.Errorf("failed to generate rootCA.pem: %w", err)
 	}
 
-	fmt.Println("Importing rootCA.pem into Windows trusted store...")
-	// Use -NoProfile and -ExecutionPolicy Bypass to reduce memory usage and ensure clean exit
-	importCmd := exec.Command("powershell.exe", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command",
-		fmt.Sprintf(`Start-Process powershell -Verb runAs -ArgumentList '-NoProfile','-ExecutionPolicy','Bypass','-Command','certutil -addstore -f Root "%s"; exit'`,
-			convertToWindowsPath(rootPem)))
-	importCmd.Stdin = os.Stdin
-	importCmd.Stdout = os.Stdout
-	importCmd.Stderr = os.Stderr
-	err := importCmd.Run()
-
-	// Force garbage collection for PowerShell process
-	if importCmd.Process != nil {
-		importCmd.Process.Kill()
-	}
-
-	return err
+	return CurrentPlatform().TrustRootCA(rootPem)
 }
 
-func generateDomainCert(domain, certsDir string) (string, string, error) {
+// generateDomainCert issues a certificate for domain and any extra names (exposed
+// subdomains). An existing certificate is kept while it covers every name.
+func generateDomainCert(domain, certsDir string, extraNames ...string) (string, string, error) {
 	domainDir := filepath.Join(certsDir, domain)
 	if err := os.MkdirAll(domainDir, 0755); err != nil {
 		return "", "", err
@@ -60,16 +50,19 @@ func generateDomainCert(domain, certsDir string) (string, string, error) {
 	keyPath := filepath.Join(domainDir, domain+".key")
 	crtPath := filepath.Join(domainDir, domain+".crt")
 
-	if _, err := os.Stat(crtPath); err == nil {
+	names := append([]string{domain}, extraNames...)
+	if certCoversNames(crtPath, names) {
 		return crtPath, keyPath, nil
 	}
 
 	csrPath := filepath.Join(domainDir, domain+".csr")
 	extPath := filepath.Join(domainDir, domain+".ext")
 
-	// domain key
-	if err := exec.Command("openssl", "genrsa", "-out", keyPath, "2048").Run(); err != nil {
-		return "", "", err
+	// domain key, reused when a certificate is issued again for more names
+	if _, err := os.Stat(keyPath); err != nil {
+		if err := exec.Command("openssl", "genrsa", "-out", keyPath, "2048").Run(); err != nil {
+			return "", "", err
+		}
 	}
 
 	// domain CSR
@@ -79,14 +72,17 @@ func generateDomainCert(domain, certsDir string) (string, string, error) {
 	}
 
 	// domain.ext
+	var altNames strings.Builder
+	for i, name := range names {
+		fmt.Fprintf(&altNames, "DNS.%d = %s\n", i+1, name)
+	}
 	extContent := fmt.Sprintf(`authorityKeyIdentifier=keyid,issuer
 basicConstraints=CA:FALSE
 keyUsage = digitalSignature, nonRepudiation, keyEncipherment, dataEncipherment
 subjectAltName = @alt_names
 
 [alt_names]
-DNS.1 = %s
-`, domain)
+%s`, altNames.String())
 	if err := os.WriteFile(extPath, []byte(extContent), 0644); err != nil {
 		return "", "", err
 	}
@@ -103,11 +99,29 @@ DNS.1 = %s
 	return crtPath, keyPath, nil
 }
 
-func convertToWindowsPath(wslPath string) string {
-	cmd := exec.Command("wslpath", "-w", wslPath)
-	out, err := cmd.Output()
+// certCoversNames reports whether the certificate at path lists every name as a SAN
+func certCoversNames(path string, names []string) bool {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return wslPath
+		return false
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	covered := make(map[string]bool, len(cert.DNSNames))
+	for _, name := range cert.DNSNames {
+		covered[name] = true
+	}
+	for _, name := range names {
+		if !covered[name] {
+			return false
+		}
 	}
-	return string(out[:len(out)-1])
+	return true
 }
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StackState holds the language versions a project's images are built with
+type StackState struct {
+	PHPVersion    string   `json:"php_version"`
+	NodeVersion   string   `json:"node_version"`
+	PHPExtensions []string `json:"php_extensions,omitempty"` // installed on top of the default set
+}
+
+// SupportedPHPVersions lists the PHP versions with an official FPM image
+var SupportedPHPVersions = []string{"7.4", "8.0", "8.1", "8.2", "8.3", "8.4"}
+
+var (
+	nodeVersionPattern  = regexp.MustCompile(`^\d+$`)
+	phpExtensionPattern = regexp.MustCompile(`^[a-z0-9_]+(-[0-9][0-9a-z.]*)?$`) // e.g. imagick or xdebug-3.1.6
+)
+
+// defaultStack returns the versions new projects get when nothing is chosen
+func defaultStack() StackState {
+	return StackState{PHPVersion: DefaultPHPVersion, NodeVersion: DefaultNodeVersion}
+}
+
+// withDefaults fills unset versions with the defaults
+func (s StackState) withDefaults() StackState {
+	if s.PHPVersion == "" {
+		s.PHPVersion = DefaultPHPVersion
+	}
+	if s.NodeVersion == "" {
+		s.NodeVersion = DefaultNodeVersion
+	}
+	return s
+}
+
+// validate checks the versions and extension names before they reach a Dockerfile
+func (s StackState) validate() error {
+	if !slices.Contains(SupportedPHPVersions, s.PHPVersion) {
+		return fmt.Errorf("unsupported PHP version %q (supported: %s)", s.PHPVersion, strings.Join(SupportedPHPVersions, ", "))
+	}
+	if !nodeVersionPattern.MatchString(s.NodeVersion) {
+		return fmt.Errorf("invalid Node.js version %q, use a major version such as 20", s.NodeVersion)
+	}
+	for _, ext := range s.PHPExtensions {
+		if !phpExtensionPattern.MatchString(ext) {
+			return fmt.Errorf("invalid PHP extension name %q", ext)
+		}
+	}
+	return nil
+}
+
+// PHPDebianRelease returns the Debian release of the PHP image. PHP 7.4 and 8.0
+// were never built on bookworm.
+func (s StackState) PHPDebianRelease() string {
+	if s.PHPVersion == "7.4" || s.PHPVersion == "8.0" {
+		return "bullseye"
+	}
+	return "bookworm"
+}
+
+// NodeDebianRelease returns the Debian release of the Node.js image
+func (s StackState) NodeDebianRelease() string {
+	if major, err := strconv.Atoi(s.NodeVersion); err == nil && major < 16 {
+		return "bullseye"
+	}
+	return "bookworm"
+}
+
+// ExtensionList returns the extra PHP extensions as install-php-extensions arguments
+func (s StackState) ExtensionList() string {
+	return strings.Join(s.PHPExtensions, " ")
+}
+
+// env returns the build settings as written to the project's .env, which compose
+// reads for the build args of docker-compose.yml
+func (s StackState) env() []EnvValue {
+	return []EnvValue{
+		{Key: "PHP_VERSION", Value: s.PHPVersion},
+		{Key: "PHP_DEBIAN_RELEASE", Value: s.PHPDebianRelease()},
+		{Key: "PHP_EXTENSIONS", Value: s.ExtensionList()},
+		{Key: "NODE_VERSION", Value: s.NodeVersion},
+		{Key: "NODE_DEBIAN_RELEASE", Value: s.NodeDebianRelease()},
+	}
+}
+
+// ParsePHPExtensions splits a comma or space separated extension list
+func ParsePHPExtensions(value string) []string {
+	var extensions []string
+	for _, ext := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !slices.Contains(extensions, ext) {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// projectStack returns the stack of a project. Projects created before versions could
+// be chosen were built with the defaults.
+func projectStack(state *ProjectState) StackState {
+	if state.Stack == nil {
+		return defaultStack()
+	}
+	return state.Stack.withDefaults()
+}
+
+// writeStackEnv writes the build settings into the project's .env
+func writeStackEnv(projectDir string, stack StackState) error {
+	return upsertEnvFile(filepath.Join(projectDir, ".env"), stack.env())
+}
+
+// SetCommand implements `dockdev set <domain> php=8.2 node=20 php-ext=imagick,xdebug [--rebuild]`
+func SetCommand(args []string) error {
+	usage := fmt.Errorf("usage: set <domain> php=<version> node=<version> php-ext=<ext,...> [--rebuild]")
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) == 0 || (len(parsed.Positional) == 1 && !parsed.Has("rebuild")) {
+		return usage
+	}
+
+	domain := parsed.Positional[0]
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+	if err := state.requireGenerated("set"); err != nil {
+		return err
+	}
+
+	stack := projectStack(state)
+	var services []string
+	for _, assignment := range parsed.Positional[1:] {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return usage
+		}
+		switch key {
+		case "php":
+			stack.PHPVersion = value
+		case "php-ext":
+			stack.PHPExtensions = ParsePHPExtensions(value)
+		case "node":
+			stack.NodeVersion = value
+		default:
+			return fmt.Errorf("unknown setting %q (use php, node or php-ext)", key)
+		}
+		service := "php"
+		if key == "node" {
+			service = "node"
+		}
+		if !slices.Contains(services, service) {
+			services = append(services, service)
+		}
+	}
+
+	// Also before `set <domain> --rebuild`, the versions go straight into a Dockerfile FROM
+	if err := stack.validate(); err != nil {
+		return err
+	}
+
+	projectDir := ProjectDir(domain)
+	if len(services) == 0 {
+		// `set <domain> --rebuild` applies settings made earlier
+		services = enabledServices(state, []string{"php", "node"})
+		if len(services) == 0 {
+			fmt.Println(Info(domain + " has no php or node service to rebuild."))
+			return nil
+		}
+		return rebuildServices(projectDir, services)
+	}
+
+	if err := writeStackEnv(projectDir, stack); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Join(projectDir, ".env"), err)
+	}
+	state.Stack = &stack
+	if err := SaveProjectState(state); err != nil {
+		return err
+	}
+	fmt.Println(Success("Updated"), Bold(domain)+Success(":"), Info(describeStack(stack)))
+
+	// Projects from before build args were added ignore the .env values
+	compose, err := os.ReadFile(filepath.Join(projectDir, DockerComposeFile))
+	if err == nil && !strings.Contains(string(compose), "PHP_VERSION") {
+		fmt.Println(Warning("This project's docker-compose.yml and Dockerfiles predate version settings."))
+		fmt.Println(Warning("Add the build args of the built-in templates (see `dockdev templates export`) before rebuilding."))
+		return nil
+	}
+
+	// Services left out of the project have no container to rebuild
+	services = enabledServices(state, services)
+	if len(services) == 0 {
+		fmt.Println(Info("The changed services are not enabled in " + domain + ", nothing to rebuild."))
+		return nil
+	}
+	if parsed.Has("rebuild") || (IsTerminal() && YesNoPrompt("Rebuild "+strings.Join(services, " and ")+" now?", true)) {
+		return rebuildServices(projectDir, services)
+	}
+	fmt.Println(Info("Apply it with:"), Highlight("dockdev set "+domain+" --rebuild"), Info("or"),
+		Highlight("docker compose up -d --build "+strings.Join(services, " ")))
+	return nil
+}
+
+// enabledServices returns the services that are not disabled in the project
+func enabledServices(state *ProjectState, services []string) []string {
+	var enabled []string
+	for _, service := range services {
+		if !slices.Contains(state.DisabledServices, service) {
+			enabled = append(enabled, service)
+		}
+	}
+	return enabled
+}
+
+// rebuildServices rebuilds the images of services and recreates their containers
+func rebuildServices(projectDir string, services []string) error {
+	PrintDivider()
+	fmt.Println(Bold("REBUILDING"), Info(strings.Join(services, ", ")))
+	cmd := composeCommand(projectDir, append([]string{"up", "-d", "--build"}, services...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rebuild failed: %w", err)
+	}
+	fmt.Println(Success("Rebuilt"), Info(strings.Join(services, ", ")))
+	return nil
+}
+
+// describeStack returns a short summary such as "PHP 8.1 (imagick, xdebug), Node.js 20"
+func describeStack(stack StackState) string {
+	php := "PHP " + stack.PHPVersion
+	if len(stack.PHPExtensions) > 0 {
+		php += " (" + strings.Join(stack.PHPExtensions, ", ") + ")"
+	}
+	return php + ", Node.js " + stack.NodeVersion
+}
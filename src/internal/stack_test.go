@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStackValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		stack StackState
+		ok    bool
+	}{
+		{name: "defaults", stack: defaultStack(), ok: true},
+		{name: "oldest php", stack: StackState{PHPVersion: "7.4", NodeVersion: "14"}, ok: true},
+		{name: "extensions", stack: StackState{PHPVersion: "8.3", NodeVersion: "20", PHPExtensions: []string{"imagick", "xdebug-3.1.6", "pdo_pgsql"}}, ok: true},
+		{name: "unsupported php", stack: StackState{PHPVersion: "5.6", NodeVersion: "20"}},
+		{name: "php patch version", stack: StackState{PHPVersion: "8.3.1", NodeVersion: "20"}},
+		{name: "empty php", stack: StackState{NodeVersion: "20"}},
+		{name: "node minor version", stack: StackState{PHPVersion: "8.3", NodeVersion: "20.1"}},
+		{name: "node tag", stack: StackState{PHPVersion: "8.3", NodeVersion: "lts"}},
+		{name: "empty node", stack: StackState{PHPVersion: "8.3"}},
+		{name: "node injecting a tag", stack: StackState{PHPVersion: "8.3", NodeVersion: "20 AS evil"}},
+		{name: "uppercase extension", stack: StackState{PHPVersion: "8.3", NodeVersion: "20", PHPExtensions: []string{"Imagick"}}},
+		{name: "extension with a space", stack: StackState{PHPVersion: "8.3", NodeVersion: "20", PHPExtensions: []string{"imagick; rm"}}},
+		{name: "extension with a bad version", stack: StackState{PHPVersion: "8.3", NodeVersion: "20", PHPExtensions: []string{"xdebug-beta"}}},
+	}
+	for _, tt := range tests {
+		if err := tt.stack.validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: validate() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestParsePHPExtensions(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "", want: nil},
+		{value: "imagick", want: []string{"imagick"}},
+		{value: "imagick,xdebug", want: []string{"imagick", "xdebug"}},
+		{value: "imagick, xdebug  redis", want: []string{"imagick", "xdebug", "redis"}},
+		{value: ",,imagick,,", want: []string{"imagick"}},
+		{value: "Imagick,imagick,IMAGICK", want: []string{"imagick"}},
+	}
+	for _, tt := range tests {
+		if got := ParsePHPExtensions(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("ParsePHPExtensions(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDebianReleases(t *testing.T) {
+	tests := []struct {
+		stack StackState
+		php   string
+		node  string
+	}{
+		{stack: StackState{PHPVersion: "7.4", NodeVersion: "14"}, php: "bullseye", node: "bullseye"},
+		{stack: StackState{PHPVersion: "8.0", NodeVersion: "15"}, php: "bullseye", node: "bullseye"},
+		{stack: StackState{PHPVersion: "8.1", NodeVersion: "16"}, php: "bookworm", node: "bookworm"},
+		{stack: StackState{PHPVersion: "8.4", NodeVersion: "22"}, php: "bookworm", node: "bookworm"},
+		{stack: StackState{PHPVersion: "8.3", NodeVersion: "lts"}, php: "bookworm", node: "bookworm"},
+	}
+	for _, tt := range tests {
+		if got := tt.stack.PHPDebianRelease(); got != tt.php {
+			t.Errorf("PHPDebianRelease() for PHP %s = %s, want %s", tt.stack.PHPVersion, got, tt.php)
+		}
+		if got := tt.stack.NodeDebianRelease(); got != tt.node {
+			t.Errorf("NodeDebianRelease() for Node.js %s = %s, want %s", tt.stack.NodeVersion, got, tt.node)
+		}
+	}
+}
+
+func TestStackWithDefaults(t *testing.T) {
+	got := StackState{PHPExtensions: []string{"imagick", "redis"}}.withDefaults()
+	if got.PHPVersion != DefaultPHPVersion || got.NodeVersion != DefaultNodeVersion {
+		t.Errorf("withDefaults() = %+v, want PHP %s and Node.js %s", got, DefaultPHPVersion, DefaultNodeVersion)
+	}
+	if got.ExtensionList() != "imagick redis" {
+		t.Errorf("ExtensionList() = %q, want %q", got.ExtensionList(), "imagick redis")
+	}
+	if err := got.validate(); err != nil {
+		t.Errorf("the defaults don't validate: %v", err)
+	}
+}
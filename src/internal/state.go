@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProjectState is what dockdev remembers about a project. It is stored in
+// domains/<domain>/.dockdev/state.json and written when the project is created.
+type ProjectState struct {
+	Domain           string            `json:"domain"`
+	Prefix           string            `json:"prefix"`
+	ComposeProject   string            `json:"compose_project,omitempty"` // empty for projects named after their directory
+	UseSSL           bool              `json:"use_ssl"`
+	IPsByService     map[string]string `json:"ips_by_service"`
+	Containers       map[string]string `json:"containers"` // compose service name -> container name
+	User             string            `json:"user"`       // uid:gid mapped into the app containers
+	Database         *DatabaseState    `json:"database,omitempty"`
+	Routes           []Route           `json:"routes,omitempty"`            // extra reverse proxy locations, see routes.go
+	Exposures        []Exposure        `json:"exposures,omitempty"`         // services on their own subdomain, see expose.go
+	Stack            *StackState       `json:"stack,omitempty"`             // empty for projects built with the default versions
+	PHPModes         *PHPModes         `json:"php_modes,omitempty"`         // runtime switches set with `dockdev php`
+	Vars             map[string]string `json:"vars,omitempty"`              // template variables set with --set or generated, see templatevars.go
+	Source           *AppSource        `json:"source,omitempty"`            // code the project was created from with --from, see source.go
+	DisabledServices []string          `json:"disabled_services,omitempty"` // template services the code has no use for
+	Adopted          *AdoptedStack     `json:"adopted,omitempty"`           // compose stack served with `dockdev adopt`, see adopt.go
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+// DatabaseState holds the project's own schema and the user that may access it
+type DatabaseState struct {
+	Engine   string `json:"engine,omitempty"` // empty for projects created before engine selection, meaning mysql
+	Name     string `json:"name"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// ProjectDir returns the project directory for a domain
+func ProjectDir(domain string) string {
+	return filepath.Join(ProjectDirPrefix, domain)
+}
+
+// projectStatePath returns the state file path for a domain
+func projectStatePath(domain string) string {
+	return filepath.Join(ProjectDir(domain), ProjectStateDir, ProjectStateFile)
+}
+
+// LoadProjectState reads the project state. Projects created before the state file
+// existed get a state reconstructed from .ipmap.env and the running containers.
+func LoadProjectState(domain string) (*ProjectState, error) {
+	content, err := os.ReadFile(projectStatePath(domain))
+	if err == nil {
+		state := &ProjectState{}
+		if err := json.Unmarshal(content, state); err != nil {
+			return nil, fmt.Errorf("failed to parse project state for %s: %w", domain, err)
+		}
+		if err := state.loadDatabasePassword(); err != nil {
+			return nil, err
+		}
+		return state, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filepath.Join(ProjectDir(domain), DockerComposeFile)); err != nil {
+		return nil, fmt.Errorf("project not found: %s", domain)
+	}
+	return legacyProjectState(domain)
+}
+
+// legacyProjectState rebuilds the state of a project that has no state file
+func legacyProjectState(domain string) (*ProjectState, error) {
+	state := &ProjectState{
+		Domain:       domain,
+		// Older releases used the first domain label, e.g. app.test -> app
+		Prefix:       strings.Split(domain, ".")[0],
+		UseSSL:       IsSSLEnabledForDomain(domain),
+		IPsByService: map[string]string{},
+		Containers:   map[string]string{},
+		User:         currentUserMapping(),
+	}
+
+	content, err := os.ReadFile(IPMapPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[0] == domain {
+			state.IPsByService["main"] = parts[1]
+		} else if strings.HasPrefix(parts[0], domain+"_") {
+			state.IPsByService[strings.TrimPrefix(parts[0], domain+"_")] = parts[1]
+		}
+	}
+
+	state.refreshContainers()
+	return state, nil
+}
+
+// SaveProjectState writes the project state file
+func SaveProjectState(state *ProjectState) error {
+	path := projectStatePath(state.Domain)
+	if err := CreateDirIfNotExist(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// With a secret store the database password is kept there instead of in the file
+	saved := *state
+	if state.Database != nil && state.Database.Password != "" {
+		store, err := secretStore()
+		if err != nil {
+			return err
+		}
+		if store != nil {
+			if err := store.Set(projectSecretKey(state.Domain), state.Database.Password); err != nil {
+				return fmt.Errorf("failed to store database password: %w", err)
+			}
+			database := *state.Database
+			database.Password = ""
+			saved.Database = &database
+		}
+	}
+
+	content, err := json.MarshalIndent(&saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0600)
+}
+
+// loadDatabasePassword fills in a database password that is kept in the secret store
+func (s *ProjectState) loadDatabasePassword() error {
+	if s.Database == nil || s.Database.Password != "" {
+		return nil
+	}
+	store, err := secretStore()
+	if err != nil || store == nil {
+		return err
+	}
+	password, err := store.Get(projectSecretKey(s.Domain))
+	if err != nil {
+		return fmt.Errorf("failed to read database password of %s: %w", s.Domain, err)
+	}
+	s.Database.Password = password
+	return nil
+}
+
+// refreshContainers updates the service to container mapping from `docker compose ps`.
+// It keeps the current mapping if Docker can't be queried.
+func (s *ProjectState) refreshContainers() {
+	statuses, err := composeServiceStatuses(ProjectDir(s.Domain))
+	if err != nil || len(statuses) == 0 {
+		return
+	}
+	if s.Containers == nil {
+		s.Containers = map[string]string{}
+	}
+	for _, status := range statuses {
+		s.Containers[status.Service] = status.Name
+	}
+}
+
+// ServiceIP returns the IP of a compose service. The nginx service is stored as "main".
+func (s *ProjectState) ServiceIP(service string) (string, error) {
+	key := service
+	if service == "nginx" {
+		key = "main"
+	}
+	if ip, ok := s.IPsByService[key]; ok {
+		return ip, nil
+	}
+
+	var known []string
+	for name := range s.IPsByService {
+		if name == "main" {
+			name = "nginx"
+		}
+		known = append(known, name)
+	}
+	sort.Strings(known)
+	return "", fmt.Errorf("service %q has no IP in project %s (known: %s)", service, s.Domain, strings.Join(known, ", "))
+}
+
+// Container returns the container name of a compose service in this project
+func (s *ProjectState) Container(service string) (string, error) {
+	if name, ok := s.Containers[service]; ok {
+		return name, nil
+	}
+
+	s.refreshContainers()
+	if name, ok := s.Containers[service]; ok {
+		return name, nil
+	}
+
+	var known []string
+	for name := range s.Containers {
+		known = append(known, name)
+	}
+	sort.Strings(known)
+	if len(known) == 0 {
+		return "", fmt.Errorf("no containers found for %s, is the project running?", s.Domain)
+	}
+	return "", fmt.Errorf("unknown service %q for %s (available: %s)", service, s.Domain, strings.Join(known, ", "))
+}
+
+// currentUserMapping returns uid:gid of the user running dockdev
+func currentUserMapping() string {
+	return fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+}
@@ -1,21 +1,440 @@
 package internal
 
 import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"text/template"
 )
 
-func RenderTemplate(templatePath string, destPath string, data interface{}) error {
-	tmpl, err := template.ParseFiles(templatePath)
+// The default templates are compiled into the binary, so dockdev runs from any directory
+//
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// templateLayer is one source of template files
+type templateLayer struct {
+	name string
+	fsys fs.FS
+}
+
+// layeredFS looks files up in several layers, the first layer holding a file wins.
+// Directory listings merge all layers.
+type layeredFS []templateLayer
+
+// Open opens the file from the highest layer that has it
+func (l layeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range l {
+		f, err := layer.fsys.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir merges the directory across layers, so an override directory only needs
+// the files that differ from the defaults
+func (l layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	var entries []fs.DirEntry
+	found := false
+	for _, layer := range l {
+		layerEntries, err := fs.ReadDir(layer.fsys, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// source returns the name of the layer a file comes from
+func (l layeredFS) source(name string) string {
+	for _, layer := range l {
+		if info, err := fs.Stat(layer.fsys, name); err == nil && !info.IsDir() {
+			return layer.name
+		}
+	}
+	return ""
+}
+
+// defaultTemplates returns the embedded templates
+func defaultTemplates() fs.FS {
+	sub, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// userTemplateDir returns ~/.config/dockdev/templates, or "" when there is no config dir
+func userTemplateDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, ConfigDirName, TemplateDir)
+}
+
+// templateFS returns the templates in lookup order: the workspace templates/ directory,
+// the user directory, then the embedded defaults
+func templateFS() layeredFS {
+	var layers layeredFS
+	if info, err := os.Stat(TemplateDir); err == nil && info.IsDir() {
+		layers = append(layers, templateLayer{name: TemplateDir + "/", fsys: os.DirFS(TemplateDir)})
+	}
+	if dir := userTemplateDir(); dir != "" {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			layers = append(layers, templateLayer{name: dir + "/", fsys: os.DirFS(dir)})
+		}
+	}
+	return append(layers, templateLayer{name: "built-in", fsys: defaultTemplates()})
+}
+
+// readTemplate reads a template by its slash separated name, e.g. "shared-services/nginx.conf.tmpl"
+func readTemplate(name string) ([]byte, error) {
+	return fs.ReadFile(templateFS(), name)
+}
+
+// parseTemplate parses a template by name with the helper functions bound to the
+// variables of data. Referencing an undeclared variable is an error, not "<no value>".
+func parseTemplate(name string, data interface{}) (*template.Template, error) {
+	content, err := readTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(path.Base(name)).
+		Funcs(templateFuncs(varsOf(data))).
+		Option("missingkey=error").
+		Parse(string(content))
+}
+
+// RenderTemplate renders a template to destPath. It is rendered in memory first, so a
+// template error doesn't leave a half written file behind.
+func RenderTemplate(templateName string, destPath string, data interface{}) error {
+	content, err := renderTemplateBytes(templateName, data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(destPath, content, 0644)
+}
+
+// renderTemplateBytes renders a template into memory
+func renderTemplateBytes(templateName string, data interface{}) ([]byte, error) {
+	tmpl, err := parseTemplate(templateName, data)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// templateFiles returns the files of a template directory, merged across layers, as
+// outputs below target. A directory missing from every layer has no files.
+func templateFiles(name, target string) ([]templateOutput, error) {
+	fsys := templateFS()
+	if !templateExists(name) {
+		return nil, nil
+	}
+
+	var outputs []templateOutput
+	err := fs.WalkDir(fsys, name, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, templateOutput{Path: path.Join(target, strings.TrimPrefix(p, name+"/")), Content: content})
+		return nil
+	})
+	return outputs, err
+}
+
+// copyTemplateDir copies a template directory, merged across layers, to dst.
+// Executable files stay executable, everything else is written 0644.
+func copyTemplateDir(name, dst string) error {
+	fsys := templateFS()
+	return fs.WalkDir(fsys, name, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(filepath.FromSlash(name), filepath.FromSlash(p))
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, mode)
+	})
+}
+
+// templateExists reports whether a template file or directory exists in any layer
+func templateExists(name string) bool {
+	_, err := fs.Stat(templateFS(), name)
+	return err == nil
+}
+
+// TemplatesCommand implements `dockdev templates export|list`
+func TemplatesCommand(args []string) error {
+	usage := fmt.Errorf("usage: templates export [dir] [--user] [--force] | templates list | templates lint [--set name=value]")
+	vars, args, err := splitSetFlags(args)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseArgs(args)
 	if err != nil {
 		return err
 	}
+	if len(parsed.Positional) == 0 {
+		return usage
+	}
+
+	switch parsed.Positional[0] {
+	case "export":
+		dir := TemplateDir
+		if parsed.Has("user") {
+			if dir = userTemplateDir(); dir == "" {
+				return fmt.Errorf("no user config directory, pass a target directory instead")
+			}
+		}
+		if len(parsed.Positional) > 1 {
+			dir = userPath(parsed.Positional[1])
+		}
+		return exportTemplates(dir, parsed.Has("force"))
+	case "list":
+		return listTemplates()
+	case "lint":
+		return lintTemplatesCommand(vars)
+	}
+	return usage
+}
+
+// exportTemplates writes the built-in templates to dir. Existing files are kept unless force is set.
+func exportTemplates(dir string, force bool) error {
+	written, skipped := 0, 0
+	err := fs.WalkDir(defaultTemplates(), ".", func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(p))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if _, err := os.Stat(target); err == nil && !force {
+			skipped++
+			return nil
+		}
+		content, err := fs.ReadFile(defaultTemplates(), p)
+		if err != nil {
+			return err
+		}
+		written++
+		return os.WriteFile(target, content, 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export templates: %w", err)
+	}
+
+	fmt.Println(Success(fmt.Sprintf("Exported %d templates to", written)), Bold(dir))
+	if skipped > 0 {
+		fmt.Println(Warning(fmt.Sprintf("Kept %d existing files, use --force to overwrite them", skipped)))
+	}
+	fmt.Println(Info("Delete the files you don't change, so they keep following dockdev updates."))
+	return nil
+}
+
+// listTemplates prints every template file and the layer it is taken from
+func listTemplates() error {
+	fsys := templateFS()
+	fmt.Println(Bold("Templates:"))
+	return fs.WalkDir(fsys, ".", func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		source := fsys.source(p)
+		if source == "built-in" {
+			source = Gray(source)
+		} else {
+			source = Highlight(source)
+		}
+		fmt.Printf("  %-50s %s\n", p, source)
+		return nil
+	})
+}
+
+// isRenderedTemplate reports whether a template file is executed rather than copied as is
+func isRenderedTemplate(name string) bool {
+	return strings.HasSuffix(name, ".tmpl") || name == "app/index.html"
+}
+
+// templateProblem is a template that fails to parse or render
+type templateProblem struct {
+	Name string
+	Err  error
+}
 
-	out, err := os.Create(destPath)
+// lintTemplates renders every template with sample data and the given variables, so
+// syntax errors, unknown fields and undeclared variables show up before a project
+// is half generated. It returns the problems and the number of templates checked.
+func lintTemplates(vars map[string]string) ([]templateProblem, int, error) {
+	ipKeys, err := ExtractIPKeysFromTemplate(DockerComposeFile + ".tmpl")
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := map[string]string{}
+	for i, key := range ipKeys {
+		ips[key] = fmt.Sprintf("10.0.100.%d", 10+i)
+	}
+
+	project := TemplateData{
+		Domain:       "example.test",
+		Prefix:       "example",
+		ProjectName:  composeProjectName("example"),
+		NetworkName:  "dockdev",
+		IPsByService: ips,
+		UseSSL:       true,
+		Stack:        defaultStack(),
+		Routes:       []SiteRoute{{Path: "/", Upstream: "http://10.0.100.10:80", WebSocket: true, Timeout: "60s", MaxBodySize: "100m"}},
+		Exposures:    []SiteExposure{{Host: "vite.example.test", Upstream: "http://10.0.100.11:5173"}},
+		Vars:         vars,
+	}
+	shared := SharedTemplateData{
+		NetworkName:      "dockdev",
+		ReverseProxyIP:   "10.0.100.2",
+		SharedMySQLIP:    "10.0.100.3",
+		MySQLUser:        "dockdev",
+		SharedMariaDBIP:  "10.0.100.4",
+		SharedPostgresIP: "10.0.100.5",
+		Engines:          map[string]bool{},
+		Vars:             vars,
+	}
+	for _, name := range SupportedEngines {
+		shared.Engines[name] = true
+	}
+
+	var problems []templateProblem
+	checked := 0
+	err = fs.WalkDir(templateFS(), ".", func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !isRenderedTemplate(p) {
+			return err
+		}
+		// Project templates are also rendered without the services --from can leave out
+		withoutServices := project
+		withoutServices.DisabledServices = []string{"php", "node"}
+		variants := []interface{}{project, withoutServices}
+		switch p {
+		case path.Join(SharedServicesDir, DockerComposeFile+".tmpl"):
+			variants = []interface{}{shared}
+		case "site.conf.tmpl":
+			plain := project
+			plain.UseSSL = false
+			variants = []interface{}{plain}
+		}
+		checked++
+		for _, data := range variants {
+			content, err := renderTemplateBytes(p, data)
+			if err == nil {
+				err = checkDisabledServices(content, data)
+			}
+			if err != nil {
+				problems = append(problems, templateProblem{Name: p, Err: err})
+				break
+			}
+		}
+		return nil
+	})
+	return problems, checked, err
+}
+
+// checkDisabledServices fails when a rendered project file still refers to the container
+// of a service the project leaves out, which nginx or compose can't resolve
+func checkDisabledServices(content []byte, data interface{}) error {
+	project, ok := data.(TemplateData)
+	if !ok {
+		return nil
+	}
+	for _, service := range project.DisabledServices {
+		if container := project.Prefix + "_" + service; bytes.Contains(content, []byte(container)) {
+			return fmt.Errorf("refers to %s, but the %s service can be left out, wrap it in {{ if .Enabled %q }}", container, service, service)
+		}
+	}
+	return nil
+}
+
+// lintTemplatesCommand implements `dockdev templates lint`
+func lintTemplatesCommand(overrides map[string]string) error {
+	vars, err := templateVars(overrides)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	return tmpl.Execute(out, data)
+	problems, checked, err := lintTemplates(vars)
+	if err != nil {
+		return err
+	}
+
+	fsys := templateFS()
+	for _, problem := range problems {
+		fmt.Println(Error("✗"), Bold(problem.Name), Gray("("+fsys.source(problem.Name)+")"))
+		fmt.Println("    " + problem.Err.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d templates failed, declare missing variables in %s or pass them with --set", len(problems), checked, TemplateManifest)
+	}
+
+	fmt.Println(Success(fmt.Sprintf("All %d templates render", checked)))
+	if len(names) > 0 {
+		fmt.Println(Info("Declared variables:"), strings.Join(names, ", "))
+	}
+	return nil
 }
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// useBuiltinTemplates makes the tests render the embedded templates only, without the
+// workspace or user overrides of the machine running them
+func useBuiltinTemplates(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+}
+
+func TestProjectTemplatesWithoutServices(t *testing.T) {
+	useBuiltinTemplates(t)
+
+	data := TemplateData{
+		Domain:       "example.test",
+		Prefix:       "example_test",
+		ProjectName:  composeProjectName("example_test"),
+		NetworkName:  "dockdev",
+		IPsByService: map[string]string{"main": "10.0.100.10", "php": "10.0.100.11", "node": "10.0.100.12"},
+		Stack:        defaultStack(),
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		disabled []string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "nginx with php",
+			template: "nginx.conf.tmpl",
+			want:     []string{"fastcgi_pass example_test_php:9000;", "location @rewrite"},
+		},
+		{
+			name:     "nginx without php",
+			template: "nginx.conf.tmpl",
+			disabled: []string{"php"},
+			want:     []string{"try_files $uri $uri/ =404;", "location = /dockdev-health"},
+			unwanted: []string{"fastcgi_pass", "@php", "@rewrite", "index.php;"},
+		},
+		{
+			name:     "compose without php and node",
+			template: DockerComposeFile + ".tmpl",
+			disabled: []string{"php", "node"},
+			want:     []string{"example_test_nginx"},
+			unwanted: []string{"example_test_php", "example_test_node"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := data
+			data.DisabledServices = tt.disabled
+			content, err := renderTemplateBytes(tt.template, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("%s has no %q", tt.template, want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(string(content), unwanted) {
+					t.Errorf("%s still has %q", tt.template, unwanted)
+				}
+			}
+		})
+	}
+}
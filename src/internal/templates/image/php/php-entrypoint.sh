@@ -1,5 +1,9 @@
 #!/bin/sh
 
+# PHP error log is written next to the nginx logs (see fastcgi_param PHP_VALUE)
+mkdir -p /var/log/nginx
+chmod 777 /var/log/nginx
+
 # Install Composer dependencies
 if [ ! -d "/var/www/html/vendor" ]; then
     composer install --no-interaction --prefer-dist --optimize-autoloader
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/joho/godotenv"
+)
+
+// templateVarPattern matches variable names usable as {{ .Vars.name }}
+var templateVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// defaultPasswordLength is the length of passwords from randomPassword without a length
+const defaultPasswordLength = 24
+
+// parseVarAssignment splits a "name=value" variable assignment
+func parseVarAssignment(assignment string) (string, string, error) {
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid variable %q, use name=value", assignment)
+	}
+	if !templateVarPattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid variable name %q, use letters, digits and underscores", name)
+	}
+	return name, value, nil
+}
+
+// manifestVars returns the variables declared in the manifest.env files of all template
+// layers. A layer overrides the defaults of the layers below it.
+func manifestVars() (map[string]string, error) {
+	vars := map[string]string{}
+	layers := templateFS()
+	for i := len(layers) - 1; i >= 0; i-- {
+		content, err := fs.ReadFile(layers[i].fsys, TemplateManifest)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		declared, err := godotenv.Unmarshal(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", TemplateManifest, layers[i].name, err)
+		}
+		for name, value := range declared {
+			if !templateVarPattern.MatchString(name) {
+				return nil, fmt.Errorf("invalid variable name %q in %s of %s", name, TemplateManifest, layers[i].name)
+			}
+			vars[name] = value
+		}
+	}
+	return vars, nil
+}
+
+// defaultTemplateVars returns the manifest variables with the TEMPLATE_VAR_<name>
+// settings of .env applied
+func defaultTemplateVars() (map[string]string, error) {
+	loadConfig()
+	vars, err := manifestVars()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if name, ok := strings.CutPrefix(key, EnvTemplateVarPrefix); ok && templateVarPattern.MatchString(name) {
+			vars[name] = value
+		}
+	}
+	return vars, nil
+}
+
+// templateVars returns the variables of a render: the defaults, then each of the
+// given sets in order, later ones win
+func templateVars(sets ...map[string]string) (map[string]string, error) {
+	vars, err := defaultTemplateVars()
+	if err != nil {
+		return nil, err
+	}
+	for _, set := range sets {
+		for name, value := range set {
+			vars[name] = value
+		}
+	}
+	return vars, nil
+}
+
+// pinnedVars returns the variables that differ from the defaults, i.e. those set with
+// --set or generated by randomPassword. Only these are stored, so changed defaults
+// reach existing projects on the next upgrade.
+func pinnedVars(vars map[string]string) (map[string]string, error) {
+	defaults, err := defaultTemplateVars()
+	if err != nil {
+		return nil, err
+	}
+	pinned := map[string]string{}
+	for name, value := range vars {
+		if current, ok := defaults[name]; !ok || current != value {
+			pinned[name] = value
+		}
+	}
+	if len(pinned) == 0 {
+		return nil, nil
+	}
+	return pinned, nil
+}
+
+// projectTemplateVars returns the variables of an existing project
+func projectTemplateVars(state *ProjectState) (map[string]string, error) {
+	return templateVars(state.Vars)
+}
+
+// sharedVarsPath returns where the pinned shared-services variables are kept
+func sharedVarsPath() string {
+	return filepath.Join(SharedServicesDir, ProjectStateDir, "vars.json")
+}
+
+// sharedTemplateVars returns the variables of the shared-services templates
+func sharedTemplateVars() (map[string]string, error) {
+	stored := map[string]string{}
+	content, err := os.ReadFile(sharedVarsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &stored); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", sharedVarsPath(), err)
+		}
+	}
+	return templateVars(stored)
+}
+
+// saveSharedTemplateVars stores the pinned shared-services variables, e.g. generated passwords
+func saveSharedTemplateVars(vars map[string]string) error {
+	pinned, err := pinnedVars(vars)
+	if err != nil || pinned == nil {
+		return err
+	}
+	if err := CreateDirIfNotExist(filepath.Dir(sharedVarsPath())); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(pinned, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sharedVarsPath(), append(content, '\n'), 0600)
+}
+
+// varsOf returns the variables carried by template data
+func varsOf(data interface{}) map[string]string {
+	switch d := data.(type) {
+	case TemplateData:
+		return d.Vars
+	case *TemplateData:
+		return d.Vars
+	case SharedTemplateData:
+		return d.Vars
+	case *SharedTemplateData:
+		return d.Vars
+	}
+	return nil
+}
+
+// templateFuncs returns the helper functions available in templates. randomPassword
+// remembers its result in vars, so a project keeps its passwords across upgrades.
+func templateFuncs(vars map[string]string) template.FuncMap {
+	return template.FuncMap{
+		"default": defaultValue,
+		"upper":   strings.ToUpper,
+		"snake":   snakeCase,
+		"env":     os.Getenv,
+		"randomPassword": func(name string, length ...int) (string, error) {
+			if value, ok := vars[name]; ok && value != "" {
+				return value, nil
+			}
+			size := defaultPasswordLength
+			if len(length) > 0 {
+				size = length[0]
+			}
+			password, err := randomPassword(size)
+			if err != nil {
+				return "", err
+			}
+			if vars != nil {
+				vars[name] = password
+			}
+			return password, nil
+		},
+	}
+}
+
+// defaultValue returns value, or fallback when value is empty: {{ .Vars.port | default "8080" }}
+func defaultValue(fallback, value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return fallback
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return fallback
+		}
+	default:
+		if v.IsZero() {
+			return fallback
+		}
+	}
+	return value
+}
+
+// snakeCase turns "MyApp.test-1" into "my_app_test_1"
+func snakeCase(s string) string {
+	var out strings.Builder
+	var prev rune
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+				out.WriteRune('_')
+			}
+			out.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			out.WriteRune(r)
+		default:
+			if prev != '_' && out.Len() > 0 {
+				out.WriteRune('_')
+			}
+			r = '_'
+		}
+		prev = r
+	}
+	return strings.TrimSuffix(out.String(), "_")
+}
+
+// splitSetFlags takes the repeatable --set name=value flags out of args
+func splitSetFlags(args []string) (map[string]string, []string, error) {
+	vars := map[string]string{}
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		assignment, ok := strings.CutPrefix(args[i], "--set=")
+		if !ok {
+			if args[i] != "--set" {
+				rest = append(rest, args[i])
+				continue
+			}
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("flag --set requires a value")
+			}
+			i++
+			assignment = args[i]
+		}
+		name, value, err := parseVarAssignment(assignment)
+		if err != nil {
+			return nil, nil, err
+		}
+		vars[name] = value
+	}
+	return vars, rest, nil
+}
+
+// SetVar applies a --set name=value option
+func (o *ProjectOptions) SetVar(assignment string) error {
+	name, value, err := parseVarAssignment(assignment)
+	if err != nil {
+		return err
+	}
+	if o.Vars == nil {
+		o.Vars = map[string]string{}
+	}
+	o.Vars[name] = value
+	return nil
+}
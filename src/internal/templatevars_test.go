@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseVarAssignment(t *testing.T) {
+	tests := []struct {
+		assignment string
+		name       string
+		value      string
+		ok         bool
+	}{
+		{assignment: "app_name=shop", name: "app_name", value: "shop", ok: true},
+		{assignment: "EMPTY=", name: "EMPTY", value: "", ok: true},
+		{assignment: "url=http://a.test/?x=1", name: "url", value: "http://a.test/?x=1", ok: true},
+		{assignment: "_private=1", name: "_private", value: "1", ok: true},
+		{assignment: "novalue"},
+		{assignment: "=value"},
+		{assignment: "1st=value"},
+		{assignment: "app-name=shop"},
+		{assignment: "app name=shop"},
+	}
+	for _, tt := range tests {
+		name, value, err := parseVarAssignment(tt.assignment)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseVarAssignment(%q) error = %v, want ok %v", tt.assignment, err, tt.ok)
+			continue
+		}
+		if name != tt.name || value != tt.value {
+			t.Errorf("parseVarAssignment(%q) = %q, %q, want %q, %q", tt.assignment, name, value, tt.name, tt.value)
+		}
+	}
+}
+
+func TestSplitSetFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		vars map[string]string
+		rest []string
+		ok   bool
+	}{
+		{name: "no flags", args: []string{"app.test", "--no-ssl"}, vars: map[string]string{}, rest: []string{"app.test", "--no-ssl"}, ok: true},
+		{name: "separate value", args: []string{"--set", "a=1", "app.test"}, vars: map[string]string{"a": "1"}, rest: []string{"app.test"}, ok: true},
+		{name: "joined value", args: []string{"app.test", "--set=a=1=2"}, vars: map[string]string{"a": "1=2"}, rest: []string{"app.test"}, ok: true},
+		{name: "repeated", args: []string{"--set", "a=1", "--set", "b=2", "--set=a=3"}, vars: map[string]string{"a": "3", "b": "2"}, ok: true},
+		{name: "empty value", args: []string{"--set", "a="}, vars: map[string]string{"a": ""}, ok: true},
+		{name: "missing value", args: []string{"app.test", "--set"}},
+		{name: "empty joined value", args: []string{"--set="}},
+		{name: "value without name", args: []string{"--set", "a"}},
+		{name: "invalid name", args: []string{"--set", "a-b=1"}},
+	}
+	for _, tt := range tests {
+		vars, rest, err := splitSetFlags(tt.args)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: splitSetFlags(%q) error = %v, want ok %v", tt.name, tt.args, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if !maps.Equal(vars, tt.vars) {
+			t.Errorf("%s: vars = %v, want %v", tt.name, vars, tt.vars)
+		}
+		if !slices.Equal(rest, tt.rest) {
+			t.Errorf("%s: rest = %q, want %q", tt.name, rest, tt.rest)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "MyApp.test-1", want: "my_app_test_1"},
+		{in: "shop.test", want: "shop_test"},
+		{in: "already_snake", want: "already_snake"},
+		{in: "a..b--c", want: "a_b_c"},
+		{in: "a-_b", want: "a_b"},
+		{in: "__leading", want: "leading"},
+		{in: "trailing__", want: "trailing"},
+		{in: ".dotted.", want: "dotted"},
+		{in: "ABC", want: "abc"},
+		{in: "v2Api", want: "v2_api"},
+		{in: "", want: ""},
+		{in: "---", want: ""},
+	}
+	for _, tt := range tests {
+		if got := snakeCase(tt.in); got != tt.want {
+			t.Errorf("snakeCase(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	var nilPointer *string
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{name: "nil", value: nil, want: "fallback"},
+		{name: "empty string", value: "", want: "fallback"},
+		{name: "string", value: "set", want: "set"},
+		{name: "zero int", value: 0, want: "fallback"},
+		{name: "int", value: 8080, want: 8080},
+		{name: "false", value: false, want: "fallback"},
+		{name: "true", value: true, want: true},
+		{name: "nil pointer", value: nilPointer, want: "fallback"},
+		{name: "empty slice", value: []string{}, want: "fallback"},
+		{name: "empty map", value: map[string]string{}, want: "fallback"},
+	}
+	for _, tt := range tests {
+		if got := defaultValue("fallback", tt.value); got != tt.want {
+			t.Errorf("%s: defaultValue = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := defaultValue("fallback", []string{"a"}); !slices.Equal(got.([]string), []string{"a"}) {
+		t.Errorf("non-empty slice: defaultValue = %v, want [a]", got)
+	}
+}
+
+// Every embedded template must render with its declared variables, including the
+// variants of projects that leave services out
+func TestLintEmbeddedTemplates(t *testing.T) {
+	useBuiltinTemplates(t)
+
+	vars, err := templateVars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, checked, err := lintTemplates(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Fatal("no templates were checked")
+	}
+	for _, problem := range problems {
+		t.Errorf("%s: %v", problem.Name, problem.Err)
+	}
+}
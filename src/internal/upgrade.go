@@ -0,0 +1,528 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// templateOutput is a file dockdev generates from the templates, relative to the
+// directory it is written to
+type templateOutput struct {
+	Path    string
+	Content []byte
+}
+
+// upgradeAction says what an upgrade does with one file
+type upgradeAction int
+
+const (
+	upgradeUnchanged upgradeAction = iota // the template didn't change
+	upgradeCurrent                        // the file already matches the template
+	upgradeCreate                         // the file is new in the template
+	upgradeReplace                        // not edited locally, take the template version
+	upgradeMerge                          // edited locally and in the template, merged cleanly
+	upgradeConflict                       // edited locally and in the template, overlapping
+	upgradeNoBase                         // edited locally, but the originally rendered version wasn't kept
+	upgradeDeleted                        // deleted locally, left alone
+)
+
+func (a upgradeAction) String() string {
+	return [...]string{"unchanged", "up to date", "new", "update", "merge", "CONFLICT", "CONFLICT (no base)", "deleted locally"}[a]
+}
+
+// fileUpgrade is the planned change of one file
+type fileUpgrade struct {
+	Path      string
+	Action    upgradeAction
+	Content   []byte // what is written
+	Template  []byte // the freshly rendered version, recorded as the next base
+	Conflicts int
+}
+
+// blocked reports whether the file can't be upgraded without losing local edits
+func (f fileUpgrade) blocked() bool {
+	return f.Action == upgradeConflict || f.Action == upgradeNoBase
+}
+
+// writes reports whether applying the upgrade changes the file
+func (f fileUpgrade) writes() bool {
+	return f.Action == upgradeCreate || f.Action == upgradeReplace || f.Action == upgradeMerge || f.blocked()
+}
+
+// baseDir returns where the originally rendered versions of files below root are kept
+func baseDir(root string) string {
+	return filepath.Join(root, ProjectStateDir, UpgradeBaseDir)
+}
+
+// readOptional reads a file, returning nil if it doesn't exist
+func readOptional(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// recordBase keeps the rendered outputs as the base of the next upgrade. Only files
+// that are on disk exactly as rendered are recorded.
+func recordBase(root string, outputs []templateOutput) error {
+	for _, output := range outputs {
+		current, err := readOptional(filepath.Join(root, filepath.FromSlash(output.Path)))
+		if err != nil {
+			return err
+		}
+		if current == nil || !bytes.Equal(current, output.Content) {
+			continue
+		}
+		if err := writeBase(root, output.Path, output.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBase stores the base version of one file
+func writeBase(root, name string, content []byte) error {
+	target := filepath.Join(baseDir(root), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, content, 0644)
+}
+
+// planUpgrade compares each output with the base it was last rendered as and the file
+// on disk, and merges where both changed. Nothing is written.
+func planUpgrade(root string, outputs []templateOutput) ([]fileUpgrade, error) {
+	var plan []fileUpgrade
+	for _, output := range outputs {
+		current, err := readOptional(filepath.Join(root, filepath.FromSlash(output.Path)))
+		if err != nil {
+			return nil, err
+		}
+		base, err := readOptional(filepath.Join(baseDir(root), filepath.FromSlash(output.Path)))
+		if err != nil {
+			return nil, err
+		}
+
+		upgrade := fileUpgrade{Path: output.Path, Content: output.Content, Template: output.Content}
+		switch {
+		case current == nil && base == nil:
+			upgrade.Action = upgradeCreate
+		case current == nil:
+			upgrade.Action = upgradeDeleted
+		case bytes.Equal(current, output.Content):
+			upgrade.Action = upgradeCurrent
+		case base == nil:
+			upgrade.Action = upgradeNoBase
+		case bytes.Equal(base, output.Content):
+			upgrade.Action = upgradeUnchanged
+		case bytes.Equal(current, base):
+			upgrade.Action = upgradeReplace
+		default:
+			merged, conflicts, err := mergeThreeWay(current, base, output.Content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to merge %s: %w", output.Path, err)
+			}
+			upgrade.Content = merged
+			upgrade.Conflicts = conflicts
+			upgrade.Action = upgradeMerge
+			if conflicts > 0 {
+				upgrade.Action = upgradeConflict
+			}
+		}
+		plan = append(plan, upgrade)
+	}
+	return plan, nil
+}
+
+// mergeThreeWay merges the template's changes since base into the local file with
+// git merge-file. It returns the merged content and the number of conflicts.
+func mergeThreeWay(current, base, template []byte) ([]byte, int, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, 0, fmt.Errorf("git is required to merge local edits with template changes")
+	}
+
+	dir, err := os.MkdirTemp("", "dockdev-merge-")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{"local": current, "base": base, "template": template}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	cmd := exec.Command("git", "merge-file", "-p", "-L", "local", "-L", "base", "-L", "template", "local", "base", "template")
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	merged, err := cmd.Output()
+
+	// The exit code is the number of conflicts, negative on errors
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		return merged, exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("git merge-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return merged, 0, nil
+}
+
+// printUpgradePlan lists the files an upgrade touches and shows the conflicting hunks
+func printUpgradePlan(root string, plan []fileUpgrade) {
+	for _, upgrade := range plan {
+		if upgrade.Action == upgradeUnchanged || upgrade.Action == upgradeCurrent {
+			continue
+		}
+		label := fmt.Sprintf("%-18s", upgrade.Action)
+		switch {
+		case upgrade.blocked():
+			label = Error(label)
+		case upgrade.Action == upgradeDeleted:
+			label = Gray(label)
+		default:
+			label = Success(label)
+		}
+		fmt.Println("  "+label, filepath.Join(root, filepath.FromSlash(upgrade.Path)))
+
+		if upgrade.Action == upgradeConflict {
+			for _, line := range conflictHunks(upgrade.Content) {
+				fmt.Println("      " + Gray(line))
+			}
+		}
+	}
+}
+
+// conflictHunks returns the lines of the conflict regions of a merge result
+func conflictHunks(merged []byte) []string {
+	var lines []string
+	inside := false
+	for _, line := range strings.Split(string(merged), "\n") {
+		if strings.HasPrefix(line, "<<<<<<< ") {
+			inside = true
+		}
+		if inside {
+			lines = append(lines, line)
+		}
+		if strings.HasPrefix(line, ">>>>>>> ") {
+			inside = false
+		}
+	}
+	return lines
+}
+
+// applyUpgrade writes the planned files and records the rendered versions as the new
+// bases. Blocked files are only written when force is set: the template version
+// replaces them and the local file is kept next to it as .orig.
+func applyUpgrade(root string, plan []fileUpgrade, force bool) error {
+	for _, upgrade := range plan {
+		target := filepath.Join(root, filepath.FromSlash(upgrade.Path))
+		if upgrade.blocked() {
+			if !force {
+				continue
+			}
+			if err := CopyFile(target, target+".orig"); err != nil {
+				return err
+			}
+			upgrade.Content = upgrade.Template
+		}
+
+		if upgrade.writes() {
+			mode := os.FileMode(0644)
+			if info, err := os.Stat(target); err == nil {
+				mode = info.Mode().Perm()
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, upgrade.Content, mode); err != nil {
+				return err
+			}
+		}
+		if upgrade.Action != upgradeDeleted {
+			if err := writeBase(root, upgrade.Path, upgrade.Template); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// projectTemplateOutputs renders every template based file of a project
+func projectTemplateOutputs(data TemplateData) ([]templateOutput, error) {
+	compose, err := renderTemplateBytes(DockerComposeFile+".tmpl", data)
+	if err != nil {
+		return nil, err
+	}
+	nginx, err := renderTemplateBytes("nginx.conf.tmpl", data)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []templateOutput{
+		{Path: DockerComposeFile, Content: compose},
+		{Path: "conf/nginx/default.conf", Content: nginx},
+	}
+	for _, dir := range ProjectFolders {
+		files, err := templateFiles(dir, dir)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, files...)
+	}
+	return outputs, nil
+}
+
+// sharedTemplateOutputs renders every template based file of shared-services
+func sharedTemplateOutputs(data SharedTemplateData) ([]templateOutput, error) {
+	compose, err := renderTemplateBytes(path.Join(SharedServicesDir, DockerComposeFile+".tmpl"), data)
+	if err != nil {
+		return nil, err
+	}
+	nginx, err := renderTemplateBytes(path.Join(SharedServicesDir, NginxConfFileName+".tmpl"), TemplateData{Vars: data.Vars})
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []templateOutput{
+		{Path: DockerComposeFile, Content: compose},
+		{Path: NginxConfFileName, Content: nginx},
+	}
+	images, err := templateFiles(path.Join(SharedServicesDir, "image"), "image")
+	if err != nil {
+		return nil, err
+	}
+	return append(outputs, images...), nil
+}
+
+// upgradeOptions are the flags of `dockdev upgrade`
+type upgradeOptions struct {
+	DryRun bool
+	Force  bool
+	Yes    bool
+	Vars   map[string]string // template variables set with --set
+}
+
+// UpgradeCommand implements `dockdev upgrade <domain>|--shared [--dry-run] [--force] [-y] [--set name=value]`
+func UpgradeCommand(args []string) error {
+	vars, args, err := splitSetFlags(args)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	opts := upgradeOptions{DryRun: parsed.Has("dry-run"), Force: parsed.Has("force"), Yes: parsed.Has("y") || parsed.Has("yes"), Vars: vars}
+
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	if parsed.Has("shared") {
+		return upgradeShared(opts)
+	}
+	if len(parsed.Positional) == 0 {
+		return fmt.Errorf("usage: upgrade <domain> | upgrade --shared [--dry-run] [--force] [-y] [--set name=value]")
+	}
+	return upgradeProject(parsed.Positional[0], opts)
+}
+
+// reviewUpgrade prints the plan and decides whether it may be written
+func reviewUpgrade(root string, plan []fileUpgrade, opts upgradeOptions) (bool, error) {
+	var blocked, changes int
+	for _, upgrade := range plan {
+		if upgrade.blocked() {
+			blocked++
+		}
+		if upgrade.writes() {
+			changes++
+		}
+	}
+	if changes == 0 {
+		fmt.Println(Success(root + " is up to date with the templates."))
+		return false, nil
+	}
+
+	fmt.Println(Bold("Changes from the templates:"))
+	printUpgradePlan(root, plan)
+
+	if blocked > 0 && !opts.Force {
+		return false, fmt.Errorf("%d file(s) conflict with local edits, nothing was written; resolve them by hand or pass --force to take the template version (local files are kept as .orig)", blocked)
+	}
+	if opts.DryRun {
+		fmt.Println(Info("Dry run, nothing was written."))
+		return false, nil
+	}
+	if !opts.Yes && IsTerminal() && !YesNoPrompt("Apply these changes?", true) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// upgradeProject renders the project templates again and merges them into the project
+func upgradeProject(domain string, opts upgradeOptions) error {
+	state, err := LoadProjectState(domain)
+	if err != nil {
+		return err
+	}
+	if err := state.requireGenerated("upgrade"); err != nil {
+		return err
+	}
+	projectDir := ProjectDir(domain)
+
+	// Services added to the template need addresses, they are recorded when the upgrade is written
+	ipKeys, err := ExtractIPKeysFromTemplate(DockerComposeFile + ".tmpl")
+	if err != nil {
+		return err
+	}
+	newIPs, err := nextServiceIPs(os.Getenv(EnvProjectStartIP), ipKeys, state.IPsByService)
+	if err != nil {
+		return err
+	}
+	ipMap := map[string]string{}
+	for key, ip := range state.IPsByService {
+		ipMap[key] = ip
+	}
+	for key, ip := range newIPs {
+		ipMap[key] = ip
+	}
+
+	data, err := siteTemplateData(state)
+	if err != nil {
+		return err
+	}
+	data.IPsByService = ipMap
+	data.NetworkName = os.Getenv(EnvNetworkName)
+	data.Stack = projectStack(state)
+	for name, value := range opts.Vars {
+		data.Vars[name] = value
+	}
+
+	outputs, err := projectTemplateOutputs(data)
+	if err != nil {
+		return err
+	}
+	plan, err := planUpgrade(projectDir, outputs)
+	if err != nil {
+		return err
+	}
+	apply, err := reviewUpgrade(projectDir, plan, opts)
+	if err != nil || !apply {
+		return err
+	}
+
+	if err := recordServiceIPs(domain, ipKeys, newIPs); err != nil {
+		return err
+	}
+	if err := applyUpgrade(projectDir, plan, opts.Force); err != nil {
+		return err
+	}
+	state.IPsByService = ipMap
+	if state.Vars, err = pinnedVars(data.Vars); err != nil {
+		return err
+	}
+	if err := SaveProjectState(state); err != nil {
+		return err
+	}
+	fmt.Println(Success("Upgraded"), Bold(domain))
+
+	if opts.Yes || (IsTerminal() && YesNoPrompt("Rebuild and recreate the project containers now?", true)) {
+		return rebuildServices(projectDir, nil)
+	}
+	fmt.Println(Info("Apply it with"), Highlight("docker compose up -d --build"), Info("in"), Info(projectDir))
+	return nil
+}
+
+// sharedTemplateData returns the shared-services template data from .env
+func sharedTemplateData() (SharedTemplateData, error) {
+	vars, err := sharedTemplateVars()
+	if err != nil {
+		return SharedTemplateData{}, err
+	}
+	return SharedTemplateData{
+		NetworkName:      os.Getenv(EnvNetworkName),
+		ReverseProxyIP:   os.Getenv(EnvReverseProxyIP),
+		SharedMySQLIP:    os.Getenv(EnvSharedMySQLIP),
+		MySQLUser:        os.Getenv(EnvMySQLUser),
+		SharedMariaDBIP:  os.Getenv(EnvSharedMariaDBIP),
+		SharedPostgresIP: os.Getenv(EnvSharedPostgresIP),
+		Vars:             vars,
+	}, nil
+}
+
+// upgradeShared renders the shared-services templates again and merges them in
+func upgradeShared(opts upgradeOptions) error {
+	composePath := filepath.Join(SharedServicesDir, DockerComposeFile)
+	if _, err := os.Stat(composePath); err != nil {
+		return fmt.Errorf("%s doesn't exist yet, it is generated with the first project", composePath)
+	}
+
+	data, err := sharedTemplateData()
+	if err != nil {
+		return err
+	}
+	engines, _, err := sharedEngineSet(composePath)
+	if err != nil {
+		return err
+	}
+	data.Engines = engines
+	for name, value := range opts.Vars {
+		data.Vars[name] = value
+	}
+
+	outputs, err := sharedTemplateOutputs(data)
+	if err != nil {
+		return err
+	}
+	plan, err := planUpgrade(SharedServicesDir, outputs)
+	if err != nil {
+		return err
+	}
+	apply, err := reviewUpgrade(SharedServicesDir, plan, opts)
+	if err != nil || !apply {
+		return err
+	}
+
+	if err := mapSharedEngineIPs(engines); err != nil {
+		return err
+	}
+	if err := writeSharedSecrets(engines); err != nil {
+		return err
+	}
+
+	proxyChange := newProxyConfigChange()
+	if err := proxyChange.track(filepath.Join(SharedServicesDir, NginxConfFileName)); err != nil {
+		return err
+	}
+	if err := applyUpgrade(SharedServicesDir, plan, opts.Force); err != nil {
+		return err
+	}
+	if err := saveSharedTemplateVars(data.Vars); err != nil {
+		return err
+	}
+	fmt.Println(Success("Upgraded"), Bold(SharedServicesDir))
+
+	if CheckDockerRunning() != nil {
+		fmt.Println(Warning("Docker is not running, the changes apply on the next start."))
+		return nil
+	}
+	if err := proxyChange.validate(); err != nil {
+		return err
+	}
+	if opts.Yes || (IsTerminal() && YesNoPrompt("Recreate the shared services now?", true)) {
+		if err := runDockerComposeUp(SharedServicesDir); err != nil {
+			return err
+		}
+	}
+	return restartNginxReverseProxy()
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// requireGit skips tests of the merge, which runs git merge-file
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+}
+
+// writeTestFile writes a file below root, creating its directories
+func writeTestFile(t *testing.T, root, name string, content []byte) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	requireGit(t)
+
+	const (
+		base     = "a\nb\nc\nd\ne\n"
+		template = "a\nb\nc\nd\nE\n"
+	)
+	tests := []struct {
+		name      string
+		current   string // "" for a missing file
+		base      string // "" for a missing base
+		template  string
+		action    upgradeAction
+		content   string
+		conflicts int
+	}{
+		{name: "new file", template: template, action: upgradeCreate, content: template},
+		{name: "deleted locally", base: base, template: template, action: upgradeDeleted, content: template},
+		{name: "already current", current: template, base: base, template: template, action: upgradeCurrent, content: template},
+		{name: "edited without base", current: "local\n", template: template, action: upgradeNoBase, content: template},
+		{name: "template unchanged", current: "a\nB\nc\nd\ne\n", base: base, template: base, action: upgradeUnchanged, content: base},
+		{name: "not edited", current: base, base: base, template: template, action: upgradeReplace, content: template},
+		{name: "edits apart", current: "A\nb\nc\nd\ne\n", base: base, template: template, action: upgradeMerge, content: "A\nb\nc\nd\nE\n"},
+		{name: "edits overlap", current: "a\nb\nc\nd\nX\n", base: base, template: template, action: upgradeConflict, conflicts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if tt.current != "" {
+				writeTestFile(t, root, "conf/site.conf", []byte(tt.current))
+			}
+			if tt.base != "" {
+				writeTestFile(t, baseDir(root), "conf/site.conf", []byte(tt.base))
+			}
+
+			plan, err := planUpgrade(root, []templateOutput{{Path: "conf/site.conf", Content: []byte(tt.template)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plan) != 1 {
+				t.Fatalf("got %d planned files, want 1", len(plan))
+			}
+			got := plan[0]
+			if got.Action != tt.action {
+				t.Errorf("action = %s, want %s", got.Action, tt.action)
+			}
+			if got.Conflicts != tt.conflicts {
+				t.Errorf("conflicts = %d, want %d", got.Conflicts, tt.conflicts)
+			}
+			if tt.content != "" && string(got.Content) != tt.content {
+				t.Errorf("content = %q, want %q", got.Content, tt.content)
+			}
+			if string(got.Template) != tt.template {
+				t.Errorf("template = %q, want %q", got.Template, tt.template)
+			}
+			if got.blocked() != (tt.action == upgradeConflict || tt.action == upgradeNoBase) {
+				t.Errorf("blocked = %v for %s", got.blocked(), tt.action)
+			}
+		})
+	}
+}
+
+func TestMergeThreeWay(t *testing.T) {
+	requireGit(t)
+
+	tests := []struct {
+		name      string
+		current   string
+		base      string
+		template  string
+		want      string // merged content, checked when there are no conflicts
+		conflicts int
+	}{
+		{name: "only template changed", current: "a\nb\n", base: "a\nb\n", template: "a\nB\n", want: "a\nB\n"},
+		{name: "only local changed", current: "A\nb\n", base: "a\nb\n", template: "a\nb\n", want: "A\nb\n"},
+		{name: "same change on both sides", current: "a\nB\n", base: "a\nb\n", template: "a\nB\n", want: "a\nB\n"},
+		{name: "separate hunks", current: "A\n1\n2\n3\nb\n", base: "a\n1\n2\n3\nb\n", template: "a\n1\n2\n3\nB\n", want: "A\n1\n2\n3\nB\n"},
+		{name: "one overlapping hunk", current: "a\nX\n", base: "a\nb\n", template: "a\nY\n", conflicts: 1},
+		{name: "two overlapping hunks", current: "X\n1\n2\n3\n4\n5\n6\n7\nX\n", base: "a\n1\n2\n3\n4\n5\n6\n7\nb\n", template: "Y\n1\n2\n3\n4\n5\n6\n7\nY\n", conflicts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts, err := mergeThreeWay([]byte(tt.current), []byte(tt.base), []byte(tt.template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conflicts != tt.conflicts {
+				t.Errorf("conflicts = %d, want %d", conflicts, tt.conflicts)
+			}
+			if tt.conflicts == 0 && string(merged) != tt.want {
+				t.Errorf("merged = %q, want %q", merged, tt.want)
+			}
+			if tt.conflicts > 0 && !strings.Contains(string(merged), "<<<<<<< local") {
+				t.Errorf("merged content has no conflict markers: %q", merged)
+			}
+		})
+	}
+}
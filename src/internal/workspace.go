@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// currentProject is the project whose directory dockdev was started in, if any
+var currentProject string
+
+// launchDir is the directory dockdev was started in, before EnterWorkspace left it
+var launchDir string
+
+// projectArgPosition maps the commands that take a project domain to the position of
+// that argument, so it can be left out inside a project directory
+var projectArgPosition = map[string]int{
+	"logs":     0,
+	"shell":    0,
+	"composer": 0,
+	"artisan":  0,
+	"npm":      0,
+	"yarn":     0,
+	"mysql":    0,
+	"expose":   0,
+	"set":      0,
+	"php":      0,
+	"upgrade":  0,
+	"rename":   0,
+	"export":   0,
+	"db":       1, // db shell|export|import <domain>, db snapshot <action> <domain>
+	"route":    1,
+}
+
+// EnterWorkspace changes to the workspace root, so the relative paths of domains/,
+// shared-services/, .env and .ipmap.env work from any directory. The root is
+// DOCKDEV_HOME, or the nearest directory above the current one that holds the
+// workspace marker (or, for workspaces from before the marker, .env next to domains/
+// or shared-services/). Without either the current directory is the workspace.
+func EnterWorkspace() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	root, err := workspaceRoot(cwd)
+	if err != nil {
+		return err
+	}
+	launchDir = cwd
+	if err := os.Chdir(root); err != nil {
+		return fmt.Errorf("failed to enter workspace %s: %w", root, err)
+	}
+
+	// Inside domains/<domain> that project is the default
+	if rel, err := filepath.Rel(root, cwd); err == nil {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) >= 2 && parts[0] == ProjectDirPrefix {
+			currentProject = parts[1]
+		}
+	}
+	return nil
+}
+
+// userPath resolves a path given on the command line, which is relative to the directory
+// dockdev was started in rather than the workspace root it runs from. ~ is the home directory.
+func userPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~"+string(filepath.Separator)); ok || path == "~" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if path == "" || filepath.IsAbs(path) || launchDir == "" {
+		return path
+	}
+	return filepath.Join(launchDir, path)
+}
+
+// workspaceRoot finds the workspace root for a directory
+func workspaceRoot(dir string) (string, error) {
+	// DOCKDEV_HOME can't come from .env, that file is found through the root
+	home := os.Getenv(EnvDockdevHome)
+	if home == "" {
+		if path := userConfigPath(); path != "" {
+			if values, err := godotenv.Read(path); err == nil {
+				home = values[EnvDockdevHome]
+			}
+		}
+	}
+	if home != "" {
+		info, err := os.Stat(home)
+		if err != nil || !info.IsDir() {
+			return "", fmt.Errorf("%s %s is not a directory", EnvDockdevHome, home)
+		}
+		return filepath.Abs(home)
+	}
+
+	for current := dir; ; {
+		if isWorkspaceRoot(current) {
+			return current, nil
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir, nil
+		}
+		current = parent
+	}
+}
+
+// isWorkspaceRoot reports whether dir is the root of a workspace
+func isWorkspaceRoot(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, WorkspaceMarker)); err == nil && !info.IsDir() {
+		return true
+	}
+	if info, err := os.Stat(filepath.Join(dir, WorkspaceConfigFile)); err != nil || info.IsDir() {
+		return false
+	}
+	for _, sub := range []string{ProjectDirPrefix, SharedServicesDir} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureWorkspaceMarker marks the current directory as a workspace root, so commands
+// run from its subdirectories find it
+func ensureWorkspaceMarker() error {
+	if _, err := os.Stat(WorkspaceMarker); err == nil {
+		return nil
+	}
+	content := "# Marks the dockdev workspace root, dockdev finds it from any directory below\n"
+	return os.WriteFile(WorkspaceMarker, []byte(content), 0644)
+}
+
+// ProjectArgs inserts the current project's domain into the arguments of a command
+// that needs one, when dockdev runs inside a project directory and no existing
+// project is named, e.g. `dockdev composer install` in domains/app.test
+func ProjectArgs(command string, args []string) []string {
+	pos, ok := projectArgPosition[command]
+	if currentProject == "" || !ok {
+		return args
+	}
+	switch {
+	case command == "db" && len(args) > 0 && args[0] == "snapshot":
+		pos = 2
+	case command == "logs" && len(args) > 0 && args[0] == "proxy":
+		return args
+	case command == "upgrade" && slices.Contains(args, "--shared"):
+		return args
+	}
+	if len(args) < pos {
+		return args
+	}
+	if len(args) > pos && isProject(args[pos]) {
+		return args
+	}
+
+	withDomain := append([]string{}, args[:pos]...)
+	withDomain = append(withDomain, currentProject)
+	return append(withDomain, args[pos:]...)
+}
+
+// isProject reports whether a project directory exists for name
+func isProject(name string) bool {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return false
+	}
+	info, err := os.Stat(ProjectDir(name))
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// useTestWorkspace runs the test in a new workspace holding the projects app.test and
+// other.test, and returns its root
+func useTestWorkspace(t *testing.T) string {
+	t.Helper()
+	useBuiltinTemplates(t)
+	t.Setenv(EnvDockdevHome, "")
+
+	root := t.TempDir()
+	writeTestFile(t, root, WorkspaceMarker, nil)
+	for _, domain := range []string{"app.test", "other.test"} {
+		if err := os.MkdirAll(filepath.Join(root, ProjectDir(domain), "public"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(root)
+
+	previousProject, previousLaunchDir := currentProject, launchDir
+	t.Cleanup(func() { currentProject, launchDir = previousProject, previousLaunchDir })
+	return root
+}
+
+func TestProjectArgs(t *testing.T) {
+	useTestWorkspace(t)
+
+	tests := []struct {
+		name    string
+		current string
+		command string
+		args    []string
+		want    []string
+	}{
+		{name: "outside a project", command: "composer", args: []string{"install"}, want: []string{"install"}},
+		{name: "command without a project", current: "app.test", command: "link", args: []string{"."}, want: []string{"."}},
+		{name: "no arguments", current: "app.test", command: "shell", want: []string{"app.test"}},
+		{name: "first argument", current: "app.test", command: "composer", args: []string{"install"}, want: []string{"app.test", "install"}},
+		{name: "named project", current: "app.test", command: "composer", args: []string{"other.test", "install"}, want: []string{"other.test", "install"}},
+		{name: "named project that doesn't exist", current: "app.test", command: "composer", args: []string{"missing.test"}, want: []string{"app.test", "missing.test"}},
+		{name: "path is no project", current: "app.test", command: "php", args: []string{"domains/other.test"}, want: []string{"app.test", "domains/other.test"}},
+		{name: "logs of a service", current: "app.test", command: "logs", args: []string{"nginx"}, want: []string{"app.test", "nginx"}},
+		{name: "logs of the proxy", current: "app.test", command: "logs", args: []string{"proxy"}, want: []string{"proxy"}},
+		{name: "upgrade", current: "app.test", command: "upgrade", args: []string{"--dry-run"}, want: []string{"app.test", "--dry-run"}},
+		{name: "upgrade shared services", current: "app.test", command: "upgrade", args: []string{"--shared"}, want: []string{"--shared"}},
+		{name: "db action", current: "app.test", command: "db", args: []string{"shell"}, want: []string{"shell", "app.test"}},
+		{name: "db action with named project", current: "app.test", command: "db", args: []string{"export", "other.test"}, want: []string{"export", "other.test"}},
+		{name: "db without an action", current: "app.test", command: "db", want: nil},
+		{name: "db snapshot", current: "app.test", command: "db", args: []string{"snapshot", "create", "before"}, want: []string{"snapshot", "create", "app.test", "before"}},
+		{name: "db snapshot with named project", current: "app.test", command: "db", args: []string{"snapshot", "list", "other.test"}, want: []string{"snapshot", "list", "other.test"}},
+		{name: "db snapshot without an action", current: "app.test", command: "db", args: []string{"snapshot"}, want: []string{"snapshot"}},
+		{name: "route action", current: "app.test", command: "route", args: []string{"add", "/api"}, want: []string{"add", "app.test", "/api"}},
+	}
+
+	for _, tt := range tests {
+		currentProject = tt.current
+		if got := ProjectArgs(tt.command, tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: ProjectArgs(%q, %q) = %q, want %q", tt.name, tt.command, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestWorkspaceRoot(t *testing.T) {
+	root := useTestWorkspace(t)
+	project := filepath.Join(root, ProjectDir("app.test"), "public")
+
+	legacy := t.TempDir()
+	writeTestFile(t, legacy, WorkspaceConfigFile, nil)
+	if err := os.MkdirAll(filepath.Join(legacy, SharedServicesDir, "mysql"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+
+	tests := []struct {
+		name string
+		dir  string
+		home string // DOCKDEV_HOME
+		want string
+	}{
+		{name: "root", dir: root, want: root},
+		{name: "below the marker", dir: project, want: root},
+		{name: "workspace without a marker", dir: filepath.Join(legacy, SharedServicesDir, "mysql"), want: legacy},
+		{name: "no workspace", dir: outside, want: outside},
+		{name: "DOCKDEV_HOME", dir: project, home: legacy, want: legacy},
+	}
+	for _, tt := range tests {
+		t.Setenv(EnvDockdevHome, tt.home)
+		got, err := workspaceRoot(tt.dir)
+		if err != nil {
+			t.Errorf("%s: workspaceRoot(%s) failed: %v", tt.name, tt.dir, err)
+		} else if got != tt.want {
+			t.Errorf("%s: workspaceRoot(%s) = %s, want %s", tt.name, tt.dir, got, tt.want)
+		}
+	}
+
+	t.Setenv(EnvDockdevHome, filepath.Join(outside, "missing"))
+	if _, err := workspaceRoot(project); err == nil {
+		t.Error("workspaceRoot accepted a DOCKDEV_HOME that doesn't exist")
+	}
+
+	// DOCKDEV_HOME from the user config, which the environment still overrides
+	t.Setenv(EnvDockdevHome, "")
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, configDir, filepath.Join(ConfigDirName, UserConfigFile), []byte(EnvDockdevHome+"="+legacy+"\n"))
+	if got, err := workspaceRoot(outside); err != nil || got != legacy {
+		t.Errorf("workspaceRoot with DOCKDEV_HOME in the user config = %s, %v, want %s", got, err, legacy)
+	}
+	t.Setenv(EnvDockdevHome, root)
+	if got, err := workspaceRoot(outside); err != nil || got != root {
+		t.Errorf("workspaceRoot with DOCKDEV_HOME in both = %s, %v, want %s", got, err, root)
+	}
+}
+
+func TestEnterWorkspace(t *testing.T) {
+	root := useTestWorkspace(t)
+	project := filepath.Join(root, ProjectDir("app.test"), "public")
+	t.Chdir(project)
+
+	if err := EnterWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	if cwd, _ := os.Getwd(); cwd != root {
+		t.Errorf("working directory = %s, want %s", cwd, root)
+	}
+	if currentProject != "app.test" {
+		t.Errorf("currentProject = %q, want app.test", currentProject)
+	}
+	if got, want := userPath("dump.sql"), filepath.Join(project, "dump.sql"); got != want {
+		t.Errorf("userPath(dump.sql) = %s, want %s", got, want)
+	}
+}